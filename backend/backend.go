@@ -0,0 +1,90 @@
+// Package backend stores the raw values of documents for the json store and
+// the meta store.
+//
+// Values are addressed by a document id and a slash-separated name within
+// the document, e.g. "data.json" or "history/3.json". Values of the store
+// itself, such as the alias table, have no document id.
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Key addresses a value.
+type Key struct {
+	Doc  string // id of the document, empty for values of the store
+	Name string
+}
+
+func (k Key) String() string {
+	if k.Doc == "" {
+		return k.Name
+	}
+	return k.Doc + "/" + k.Name
+}
+
+// Op is a write of a batch. A nil Data removes the value.
+type Op struct {
+	Key  Key
+	Data []byte
+}
+
+// ErrNotFound is returned by Load when the value does not exist.
+var ErrNotFound = errors.New("value not found")
+
+// Backend is where the stores keep their values. It must be safe for
+// concurrent use.
+type Backend interface {
+	// Load returns a value and the time it was saved.
+	Load(k Key) ([]byte, time.Time, error)
+	// Save writes a value atomically.
+	Save(k Key, data []byte) error
+	// Delete removes a value. A key without name removes the document with
+	// all its values. Removing a missing value is not an error.
+	Delete(k Key) error
+	// List returns the names of the values of a document which start with
+	// prefix, in ascending order.
+	List(doc, prefix string) ([]string, error)
+	// Docs returns the ids of the documents. It may include documents
+	// without values, which are left by interrupted creates.
+	Docs() ([]string, error)
+	// Batch applies the writes atomically, in order. If it fails, the
+	// writes are either discarded or finished before any other access.
+	Batch(ops []Op) error
+	// Close releases the resources of the backend.
+	Close() error
+}
+
+// New opens the backend selected by the config.
+func New(dataDir config.DataDir, conf *config.Config, logger *util.Logger) (Backend, error) {
+	var b Backend
+	var err error
+	switch conf.Backend {
+	case "", config.FileBackend:
+		b, err = NewFile(string(dataDir), logger)
+	case config.MemoryBackend:
+		b = NewMemory()
+	case config.BoltBackend:
+		b, err = NewBolt(string(dataDir))
+	default:
+		err = errors.Errorf("unknown backend %s", conf.Backend)
+	}
+	if err != nil {
+		logger.Errorw("failed to open backend", "backend", conf.Backend, zap.Error(err))
+		return nil, err
+	}
+	return b, nil
+}
+
+// Quarantine moves a damaged value aside so that it can be inspected later,
+// and returns its new key.
+func Quarantine(b Backend, k Key, data []byte) (Key, error) {
+	to := Key{Doc: k.Doc, Name: fmt.Sprintf("%s.torn-%d", k.Name, time.Now().Unix())}
+	return to, b.Batch([]Op{{Key: to, Data: data}, {Key: k}})
+}
@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackends(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	for _, name := range []string{config.FileBackend, config.MemoryBackend, config.BoltBackend} {
+		dir := filepath.Join(dataDir, name)
+		r.Nil(os.Mkdir(dir, 0755))
+		b, err := New(config.DataDir(dir), &config.Config{Backend: name}, util.NewLogger())
+		r.Nil(err)
+
+		_, _, err = b.Load(Key{Doc: "a", Name: "data.json"})
+		r.Equal(ErrNotFound, err, name)
+		r.Nil(b.Save(Key{Doc: "a", Name: "data.json"}, []byte(`1`)))
+		r.Nil(b.Save(Key{Name: "aliases.json"}, []byte(`{}`)))
+		r.Nil(b.Batch([]Op{
+			{Key: Key{Doc: "a", Name: "history/1.json"}, Data: []byte(`{}`)},
+			{Key: Key{Doc: "b", Name: "data.json"}, Data: []byte(`2`)},
+			{Key: Key{Doc: "a", Name: "history/0.json"}},
+		}))
+		data, modTime, err := b.Load(Key{Doc: "a", Name: "data.json"})
+		r.Nil(err)
+		r.Equal(`1`, string(data))
+		r.False(modTime.IsZero())
+
+		names, err := b.List("a", "")
+		r.Nil(err)
+		r.Equal([]string{"data.json", "history/1.json"}, names, name)
+		names, err = b.List("a", "history/")
+		r.Nil(err)
+		r.Equal([]string{"history/1.json"}, names)
+		names, err = b.List("", "")
+		r.Nil(err)
+		r.Contains(names, "aliases.json")
+		ids, err := b.Docs()
+		r.Nil(err)
+		r.ElementsMatch([]string{"a", "b"}, ids)
+
+		r.Nil(b.Delete(Key{Doc: "b", Name: "data.json"}))
+		r.Nil(b.Delete(Key{Doc: "b", Name: "data.json"}))
+		_, _, err = b.Load(Key{Doc: "b", Name: "data.json"})
+		r.Equal(ErrNotFound, err)
+		r.Nil(b.Delete(Key{Doc: "a"}))
+		names, err = b.List("a", "")
+		r.Nil(err)
+		r.Empty(names)
+		r.Nil(b.Close())
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	r := require.New(t)
+	b := NewMemory()
+	k := Key{Doc: "a", Name: "data.json"}
+	r.Nil(b.Save(k, []byte(`{"foo":"b`)))
+	to, err := Quarantine(b, k, []byte(`{"foo":"b`))
+	r.Nil(err)
+	_, _, err = b.Load(k)
+	r.Equal(ErrNotFound, err)
+	data, _, err := b.Load(to)
+	r.Nil(err)
+	r.Equal(`{"foo":"b`, string(data))
+}
@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt keeps values in a bbolt database in the data dir, which suits many
+// small documents better than a dir for each. Each document has a bucket
+// in the docs bucket, values of the store are in the store bucket.
+//
+// A value is stored after the time it was saved, in unix nanoseconds.
+type Bolt struct {
+	db *bolt.DB
+}
+
+var (
+	docsBucket  = []byte("docs")
+	storeBucket = []byte("store")
+)
+
+// NewBolt opens the database in the data dir, or creates it on the first
+// run.
+func NewBolt(dataDir string) (*Bolt, error) {
+	db, err := bolt.Open(filepath.Join(dataDir, boltFname), 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{docsBucket, storeBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.WithStack(err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+const boltFname = "luson.db"
+
+func (b *Bolt) Load(k Key) ([]byte, time.Time, error) {
+	var data []byte
+	var modTime time.Time
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := b.bucket(tx, k.Doc)
+		if bucket == nil {
+			return ErrNotFound
+		}
+		v := bucket.Get([]byte(k.Name))
+		if v == nil {
+			return ErrNotFound
+		}
+		if len(v) < 8 {
+			return errors.Errorf("invalid value %s", k)
+		}
+		modTime = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+		data = append([]byte(nil), v[8:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, modTime, nil
+}
+
+func (b *Bolt) Save(k Key, data []byte) error {
+	return b.Batch([]Op{{Key: k, Data: data}})
+}
+
+func (b *Bolt) Delete(k Key) error {
+	return b.Batch([]Op{{Key: k}})
+}
+
+func (b *Bolt) List(doc, prefix string) ([]string, error) {
+	var names []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := b.bucket(tx, doc)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			names = append(names, string(k))
+		}
+		return nil
+	})
+	return names, errors.WithStack(err)
+}
+
+func (b *Bolt) Docs() ([]string, error) {
+	var ids []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(docsBucket).ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	return ids, errors.WithStack(err)
+}
+
+func (b *Bolt) Batch(ops []Op) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		now := make([]byte, 8)
+		binary.BigEndian.PutUint64(now, uint64(time.Now().UnixNano()))
+		for _, op := range ops {
+			if op.Key.Doc != "" && op.Key.Name == "" {
+				err := tx.Bucket(docsBucket).DeleteBucket([]byte(op.Key.Doc))
+				if err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+				continue
+			}
+			bucket := b.bucket(tx, op.Key.Doc)
+			if op.Data == nil {
+				if bucket == nil {
+					continue
+				}
+				if err := bucket.Delete([]byte(op.Key.Name)); err != nil {
+					return err
+				}
+				continue
+			}
+			if bucket == nil {
+				var err error
+				if bucket, err = tx.Bucket(docsBucket).CreateBucket([]byte(op.Key.Doc)); err != nil {
+					return err
+				}
+			}
+			if err := bucket.Put([]byte(op.Key.Name), append(now[:8:8], op.Data...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// bucket returns the bucket of a document, or nil if it has no values.
+func (b *Bolt) bucket(tx *bolt.Tx, doc string) *bolt.Bucket {
+	if doc == "" {
+		return tx.Bucket(storeBucket)
+	}
+	return tx.Bucket(docsBucket).Bucket([]byte(doc))
+}
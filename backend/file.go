@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disksing/luson/util"
+	"go.uber.org/zap"
+)
+
+// File keeps a dir for each document in the data dir, with a file for each
+// value. Dir names are encoded by util.DirName, so ids cannot refer to
+// anything other than a child of the data dir.
+type File struct {
+	dataDir string
+	logger  *util.Logger
+	wal     *wal
+
+	sync.Mutex
+	walPending bool
+}
+
+// NewFile opens the data dir. Temp files of interrupted writes are removed,
+// and the batch left in the WAL is finished.
+func NewFile(dataDir string, logger *util.Logger) (*File, error) {
+	f := &File{
+		dataDir: dataDir,
+		logger:  logger,
+		wal:     newWAL(dataDir),
+	}
+	tmps, err := f.removeTempFiles()
+	if err != nil {
+		logger.Errorw("failed to remove temp files", zap.Error(err))
+		return nil, err
+	}
+	if len(tmps) > 0 {
+		logger.Warnw("temp files of interrupted writes removed", "files", tmps)
+	}
+	if err = f.replay(); err != nil {
+		logger.Errorw("failed to replay wal", zap.Error(err))
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) removeTempFiles() ([]string, error) {
+	var tmps []string
+	err := filepath.Walk(f.dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !util.IsTempFile(info.Name()) {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		tmps = append(tmps, path)
+		return nil
+	})
+	return tmps, err
+}
+
+func (f *File) Load(k Key) ([]byte, time.Time, error) {
+	if err := f.finish(); err != nil {
+		return nil, time.Time{}, err
+	}
+	fname := f.fname(k)
+	b, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	stat, err := os.Stat(fname)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return b, stat.ModTime(), nil
+}
+
+func (f *File) Save(k Key, data []byte) error {
+	if err := f.finish(); err != nil {
+		return err
+	}
+	return f.save(k, data)
+}
+
+func (f *File) Delete(k Key) error {
+	if err := f.finish(); err != nil {
+		return err
+	}
+	return f.delete(k)
+}
+
+func (f *File) List(doc, prefix string) ([]string, error) {
+	if err := f.finish(); err != nil {
+		return nil, err
+	}
+	dir := f.fname(Key{Doc: doc})
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Dirs of documents are not values of the store.
+			if _, ok := util.IDFromDirName(info.Name()); ok && doc == "" && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *File) Docs() ([]string, error) {
+	fs, err := ioutil.ReadDir(f.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range fs {
+		if !fi.IsDir() {
+			continue
+		}
+		if id, ok := util.IDFromDirName(fi.Name()); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Batch writes a single value in one step, other batches are logged in the
+// WAL first. A failed batch is finished before the next access.
+func (f *File) Batch(ops []Op) error {
+	if len(ops) == 1 {
+		if err := f.finish(); err != nil {
+			return err
+		}
+		return f.apply(ops[0])
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.walPending {
+		if err := f.replayLocked(); err != nil {
+			return err
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := f.wal.write(ops); err != nil {
+		return err
+	}
+	f.walPending = true
+	for _, op := range ops {
+		if applyHook != nil {
+			if err := applyHook(op.Key); err != nil {
+				return err
+			}
+		}
+		if err := f.apply(op); err != nil {
+			return err
+		}
+	}
+	if err := f.wal.clear(); err != nil {
+		return err
+	}
+	f.walPending = false
+	return nil
+}
+
+// applyHook is called before each write of a logged batch is applied. Tests
+// use it to simulate a crash in the middle of Batch.
+var applyHook func(k Key) error
+
+func (f *File) Close() error {
+	return nil
+}
+
+// finish redoes the batch which failed to apply.
+func (f *File) finish() error {
+	f.Lock()
+	defer f.Unlock()
+	if !f.walPending {
+		return nil
+	}
+	return f.replayLocked()
+}
+
+func (f *File) replay() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.replayLocked()
+}
+
+// replayLocked redoes the batch left in the WAL by a crash or a failed Batch.
+// An incomplete record is discarded, since none of its writes were applied
+// yet.
+func (f *File) replayLocked() error {
+	ops, err := f.wal.read()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if err = f.apply(op); err != nil {
+			return err
+		}
+		keys = append(keys, op.Key.String())
+	}
+	if len(ops) > 0 {
+		f.logger.Infow("wal replayed", "keys", keys)
+	} else if f.wal.exists() {
+		f.logger.Warn("incomplete wal record discarded")
+	}
+	if err = f.wal.clear(); err != nil {
+		return err
+	}
+	f.walPending = false
+	return nil
+}
+
+func (f *File) apply(op Op) error {
+	if op.Data == nil {
+		return f.delete(op.Key)
+	}
+	return f.save(op.Key, op.Data)
+}
+
+func (f *File) save(k Key, data []byte) error {
+	fname := f.fname(k)
+	if err := mkdir(filepath.Dir(fname)); err != nil {
+		return err
+	}
+	return util.WriteFile(fname, data, 0644)
+}
+
+func (f *File) delete(k Key) error {
+	if k.Name == "" {
+		if err := os.RemoveAll(f.fname(k)); err != nil {
+			return err
+		}
+		return util.SyncDir(f.dataDir)
+	}
+	err := os.Remove(f.fname(k))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *File) fname(k Key) string {
+	if k.Doc == "" {
+		return filepath.Join(f.dataDir, filepath.FromSlash(k.Name))
+	}
+	return filepath.Join(f.dataDir, util.DirName(k.Doc), filepath.FromSlash(k.Name))
+}
+
+// mkdir creates a dir and its parents durably.
+func mkdir(dir string) error {
+	_, err := os.Stat(dir)
+	if !os.IsNotExist(err) {
+		return err
+	}
+	parent := filepath.Dir(dir)
+	if err = mkdir(parent); err != nil {
+		return err
+	}
+	if err = os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return util.SyncDir(parent)
+}
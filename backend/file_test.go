@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFile(r *require.Assertions, dataDir string) *File {
+	f, err := NewFile(dataDir, util.NewLogger())
+	r.Nil(err)
+	return f
+}
+
+func readFile(r *require.Assertions, dataDir, id string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dataDir, util.DirName(id), "data.json"))
+	r.Nil(err)
+	return string(b)
+}
+
+func dataOp(id, data string) Op {
+	return Op{Key: Key{Doc: id, Name: "data.json"}, Data: []byte(data)}
+}
+
+func TestFileCrashRecovery(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	f := newTestFile(r, dataDir)
+	r.Nil(f.Batch([]Op{dataOp("a", `"a0"`), dataOp("b", `"b0"`)}))
+
+	// Crash after "a" is written but before "b".
+	applyHook = func(k Key) error {
+		if k.Doc == "b" {
+			return errors.New("crash")
+		}
+		return nil
+	}
+	defer func() { applyHook = nil }()
+	r.NotNil(f.Batch([]Op{dataOp("a", `"a1"`), dataOp("b", `"b1"`)}))
+	r.Equal(`"a1"`, readFile(r, dataDir, "a"))
+	r.Equal(`"b0"`, readFile(r, dataDir, "b"))
+	applyHook = nil
+
+	// Restart finishes the batch.
+	f = newTestFile(r, dataDir)
+	r.Equal(`"a1"`, readFile(r, dataDir, "a"))
+	r.Equal(`"b1"`, readFile(r, dataDir, "b"))
+	b, _, err := f.Load(Key{Doc: "b", Name: "data.json"})
+	r.Nil(err)
+	r.Equal(`"b1"`, string(b))
+	r.False(f.wal.exists())
+}
+
+func TestFileFailedBatchReplayed(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	f := newTestFile(r, dataDir)
+	applyHook = func(k Key) error {
+		if k.Doc == "b" {
+			return errors.New("disk error")
+		}
+		return nil
+	}
+	r.NotNil(f.Batch([]Op{dataOp("a", `"a1"`), dataOp("b", `"b1"`)}))
+	applyHook = nil
+
+	// The next access completes the pending batch first.
+	b, _, err := f.Load(Key{Doc: "b", Name: "data.json"})
+	r.Nil(err)
+	r.Equal(`"b1"`, string(b))
+	r.Nil(f.Save(Key{Doc: "a", Name: "data.json"}, []byte(`"a2"`)))
+	r.Equal(`"a2"`, readFile(r, dataDir, "a"))
+	r.Equal(`"b1"`, readFile(r, dataDir, "b"))
+}
+
+func TestFileTornWALDiscarded(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	f := newTestFile(r, dataDir)
+	r.Nil(f.Batch([]Op{dataOp("a", `"a0"`), dataOp("b", `"b0"`)}))
+
+	// Crash while the WAL record itself is being written.
+	r.Nil(f.wal.write([]Op{dataOp("a", `"a1"`), dataOp("b", `"b1"`)}))
+	b, err := ioutil.ReadFile(f.wal.fname)
+	r.Nil(err)
+	r.Nil(ioutil.WriteFile(f.wal.fname, b[:len(b)-5], 0644))
+
+	f = newTestFile(r, dataDir)
+	r.Equal(`"a0"`, readFile(r, dataDir, "a"))
+	r.Equal(`"b0"`, readFile(r, dataDir, "b"))
+	r.False(f.wal.exists())
+}
@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps values in memory. Nothing survives a restart, so it suits
+// tests and throwaway servers.
+type Memory struct {
+	sync.Mutex
+	docs map[string]map[string]memValue // id => name => value
+}
+
+type memValue struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemory creates an empty memory backend.
+func NewMemory() *Memory {
+	return &Memory{docs: make(map[string]map[string]memValue)}
+}
+
+func (m *Memory) Load(k Key) ([]byte, time.Time, error) {
+	m.Lock()
+	defer m.Unlock()
+	v, ok := m.docs[k.Doc][k.Name]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return append([]byte(nil), v.data...), v.modTime, nil
+}
+
+func (m *Memory) Save(k Key, data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	m.save(k, data)
+	return nil
+}
+
+func (m *Memory) Delete(k Key) error {
+	m.Lock()
+	defer m.Unlock()
+	m.delete(k)
+	return nil
+}
+
+func (m *Memory) List(doc, prefix string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	var names []string
+	for name := range m.docs[doc] {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *Memory) Docs() ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	ids := make([]string, 0, len(m.docs))
+	for id := range m.docs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) Batch(ops []Op) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, op := range ops {
+		if op.Data == nil {
+			m.delete(op.Key)
+		} else {
+			m.save(op.Key, op.Data)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) save(k Key, data []byte) {
+	doc, ok := m.docs[k.Doc]
+	if !ok {
+		doc = make(map[string]memValue)
+		m.docs[k.Doc] = doc
+	}
+	doc[k.Name] = memValue{data: append([]byte(nil), data...), modTime: time.Now()}
+}
+
+func (m *Memory) delete(k Key) {
+	if k.Name == "" {
+		delete(m.docs, k.Doc)
+		return
+	}
+	doc := m.docs[k.Doc]
+	delete(doc, k.Name)
+	if len(doc) == 0 {
+		delete(m.docs, k.Doc)
+	}
+}
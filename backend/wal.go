@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+)
+
+// wal is a write-ahead log holding the batch being applied. The record is
+// durable before any value is touched, so a crash in the middle of Batch can
+// be redone on the next startup.
+//
+// The file consists of the hex sha1 of the body, a newline, and the body. A
+// record which fails the checksum was never committed and is discarded.
+type wal struct {
+	fname string
+}
+
+type walRecord struct {
+	Ops []walOp `json:"ops"`
+}
+
+type walOp struct {
+	Doc  string `json:"doc,omitempty"`
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+func newWAL(dataDir string) *wal {
+	return &wal{fname: filepath.Join(dataDir, "txn.wal")}
+}
+
+func (w *wal) write(ops []Op) error {
+	rec := walRecord{Ops: make([]walOp, 0, len(ops))}
+	for _, op := range ops {
+		rec.Ops = append(rec.Ops, walOp{Doc: op.Key.Doc, Name: op.Key.Name, Data: op.Data})
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(w.fname, append([]byte(checksum(body)+"\n"), body...), 0644)
+}
+
+// read returns the pending batch, or nil if there is no complete record.
+func (w *wal) read() ([]Op, error) {
+	b, err := ioutil.ReadFile(w.fname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 || string(b[:i]) != checksum(b[i+1:]) {
+		return nil, nil
+	}
+	var rec walRecord
+	if err = json.Unmarshal(b[i+1:], &rec); err != nil {
+		return nil, nil
+	}
+	ops := make([]Op, 0, len(rec.Ops))
+	for _, op := range rec.Ops {
+		ops = append(ops, Op{Key: Key{Doc: op.Doc, Name: op.Name}, Data: op.Data})
+	}
+	return ops, nil
+}
+
+func (w *wal) exists() bool {
+	_, err := os.Stat(w.fname)
+	return err == nil
+}
+
+func (w *wal) clear() error {
+	err := os.Remove(w.fname)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// A stale record must not be replayed over later writes.
+	return util.SyncDir(filepath.Dir(w.fname))
+}
+
+func checksum(b []byte) string {
+	sh := sha1.Sum(b)
+	return hex.EncodeToString(sh[:])
+}
@@ -0,0 +1,424 @@
+// Package codec converts JSON values from and to other formats: YAML, TOML,
+// CBOR and MessagePack.
+//
+// Decoded values are plain JSON values, as jsonp.Unmarshal returns: objects
+// are map[string]interface{}, arrays are []interface{} and numbers are
+// json.Number. Values without a JSON counterpart are converted: binary data to
+// base64 strings, times to RFC 3339 strings and scalar keys to strings.
+//
+// Encoded numbers keep all their digits in YAML, which writes them as they
+// are, and in CBOR for integers, which may be bignums. Other numbers are
+// encoded as 64-bit integers or floats, and fail to encode if that loses
+// precision, so a value is never changed silently.
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/disksing/luson/jsonp"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Codec decodes and encodes JSON values in a format.
+type Codec struct {
+	Name string
+	// MediaTypes of the format, the first one is used in responses.
+	MediaTypes []string
+
+	decode func(data []byte, v *interface{}) error
+	encode func(v interface{}) ([]byte, error)
+	// number converts a number to be encoded.
+	number func(n json.Number) (interface{}, error)
+}
+
+var (
+	JSON = &Codec{
+		Name:       "json",
+		MediaTypes: []string{"application/json"},
+		decode:     func(data []byte, v *interface{}) error { return jsonp.Unmarshal(data, v) },
+		encode:     json.Marshal,
+	}
+	YAML = &Codec{
+		Name:       "yaml",
+		MediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+		decode:     decodeYAML,
+		encode:     yaml.Marshal,
+		number:     yamlNumber,
+	}
+	TOML = &Codec{
+		Name:       "toml",
+		MediaTypes: []string{"application/toml"},
+		decode:     decodeTOML,
+		encode:     encodeTOML,
+		number:     tomlNumber,
+	}
+	CBOR = &Codec{
+		Name:       "cbor",
+		MediaTypes: []string{"application/cbor"},
+		decode:     decodeCBOR,
+		encode:     cbor.Marshal,
+		number:     cborNumber,
+	}
+	MessagePack = &Codec{
+		Name:       "msgpack",
+		MediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		decode:     decodeMessagePack,
+		encode:     msgpack.Marshal,
+		number:     msgpackNumber,
+	}
+)
+
+// All are the supported codecs, in the order of preference.
+var All = []*Codec{JSON, YAML, TOML, CBOR, MessagePack}
+
+// ErrNotObject is the cause of errors encoding non-object values in formats
+// which only have documents of objects.
+var ErrNotObject = errors.New("not an object")
+
+// ByMediaType returns the codec of a media type, or nil if it is not
+// supported.
+func ByMediaType(t string) *Codec {
+	for _, c := range All {
+		for _, mt := range c.MediaTypes {
+			if mt == t {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Decode parses data to a JSON value.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := c.decode(data, &v); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", c.Name)
+	}
+	if c == JSON {
+		return v, nil
+	}
+	return normalize(v)
+}
+
+// Encode formats a value. Values other than JSON values are converted as
+// encoding/json does first.
+func (c *Codec) Encode(v interface{}) ([]byte, error) {
+	if c == JSON {
+		return c.encode(v)
+	}
+	v, err := native(v, c.number)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.encode(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot encode as %s", c.Name)
+	}
+	return data, nil
+}
+
+// normalize converts a decoded value to a JSON value.
+func normalize(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, bool, string, json.Number:
+		return x, nil
+	case int:
+		return json.Number(strconv.FormatInt(int64(x), 10)), nil
+	case int8:
+		return json.Number(strconv.FormatInt(int64(x), 10)), nil
+	case int16:
+		return json.Number(strconv.FormatInt(int64(x), 10)), nil
+	case int32:
+		return json.Number(strconv.FormatInt(int64(x), 10)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(x, 10)), nil
+	case uint:
+		return json.Number(strconv.FormatUint(uint64(x), 10)), nil
+	case uint8:
+		return json.Number(strconv.FormatUint(uint64(x), 10)), nil
+	case uint16:
+		return json.Number(strconv.FormatUint(uint64(x), 10)), nil
+	case uint32:
+		return json.Number(strconv.FormatUint(uint64(x), 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(x, 10)), nil
+	case float32:
+		return floatNumber(float64(x), 32)
+	case float64:
+		return floatNumber(x, 64)
+	case big.Int:
+		return json.Number(x.String()), nil
+	case *big.Int:
+		return json.Number(x.String()), nil
+	case cbor.Tag:
+		return bignum(x)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x), nil
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+	case map[string]interface{}:
+		for k, e := range x {
+			n, err := normalize(e)
+			if err != nil {
+				return nil, err
+			}
+			x[k] = n
+		}
+		return x, nil
+	case []interface{}:
+		for i, e := range x {
+			n, err := normalize(e)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = n
+		}
+		return x, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		obj := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := mapKey(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if obj[k], err = normalize(iter.Value().Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case reflect.Slice, reflect.Array:
+		arr := make([]interface{}, rv.Len())
+		for i := range arr {
+			var err error
+			if arr[i], err = normalize(rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, errors.Errorf("unsupported value %T", v)
+}
+
+// bignum converts CBOR bignums (RFC 7049 section 2.4.2).
+func bignum(t cbor.Tag) (interface{}, error) {
+	b, ok := t.Content.([]byte)
+	if !ok || (t.Number != 2 && t.Number != 3) {
+		return nil, errors.Errorf("unsupported tag %d", t.Number)
+	}
+	n := new(big.Int).SetBytes(b)
+	if t.Number == 3 {
+		n.Sub(big.NewInt(-1), n)
+	}
+	return json.Number(n.String()), nil
+}
+
+func floatNumber(f float64, bits int) (interface{}, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.Errorf("unsupported number %v", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bits)), nil
+}
+
+// mapKey converts a scalar key to a string.
+func mapKey(k interface{}) (string, error) {
+	switch x := k.(type) {
+	case string:
+		return x, nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(x), nil
+	case float32, float64:
+		n, err := normalize(x)
+		if err != nil {
+			return "", err
+		}
+		return string(n.(json.Number)), nil
+	}
+	return "", errors.Errorf("unsupported key %v", k)
+}
+
+// native converts a value to be encoded, numbers by the number function.
+func native(v interface{}, number func(n json.Number) (interface{}, error)) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, bool, string, float64:
+		return x, nil
+	case json.Number:
+		return number(x)
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			var err error
+			if obj[k], err = native(e, number); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, e := range x {
+			var err error
+			if arr[i], err = native(e, number); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	// Structs and others, as encoding/json sees them.
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var x interface{}
+	if err = jsonp.Unmarshal(data, &x); err != nil {
+		return nil, err
+	}
+	return native(x, number)
+}
+
+// numberLiteral is a number written in YAML as its decimal text, which is a
+// number in the core schema of any size.
+type numberLiteral json.Number
+
+func (n numberLiteral) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: string(n)}, nil
+}
+
+func yamlNumber(n json.Number) (interface{}, error) {
+	return numberLiteral(n), nil
+}
+
+func tomlNumber(n json.Number) (interface{}, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	return exactFloat(n)
+}
+
+func msgpackNumber(n json.Number) (interface{}, error) {
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u, nil
+	}
+	return tomlNumber(n)
+}
+
+// cborNumber converts integers out of 64 bits to bignums.
+func cborNumber(n json.Number) (interface{}, error) {
+	if x, err := msgpackNumber(n); err == nil {
+		return x, nil
+	}
+	b, ok := new(big.Int).SetString(string(n), 10)
+	if !ok {
+		return exactFloat(n)
+	}
+	if b.Sign() >= 0 {
+		return cbor.Tag{Number: 2, Content: b.Bytes()}, nil
+	}
+	return cbor.Tag{Number: 3, Content: b.Sub(big.NewInt(-1), b).Bytes()}, nil
+}
+
+// exactFloat converts a number to float64 if the float is decoded back as
+// the same number.
+func exactFloat(n json.Number) (interface{}, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || !jsonp.Equal(n, json.Number(strconv.FormatFloat(f, 'g', -1, 64))) {
+		return nil, errors.Errorf("number cannot be encoded exactly %s", n)
+	}
+	return f, nil
+}
+
+// errTrailingData is returned for data after the first value.
+var errTrailingData = errors.New("invalid data after top-level value")
+
+func decodeYAML(data []byte, v *interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	var more interface{}
+	if err := dec.Decode(&more); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+func decodeCBOR(data []byte, v *interface{}) error {
+	dec := cbor.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.NumBytesRead() != len(data) {
+		return errTrailingData
+	}
+	return nil
+}
+
+func decodeMessagePack(data []byte, v *interface{}) error {
+	r := bytes.NewReader(data)
+	if err := msgpack.NewDecoder(r).Decode(v); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errTrailingData
+	}
+	return nil
+}
+
+func decodeTOML(data []byte, v *interface{}) error {
+	var obj map[string]interface{}
+	if _, err := toml.Decode(string(data), &obj); err != nil {
+		return err
+	}
+	*v = obj
+	return nil
+}
+
+func encodeTOML(v interface{}) ([]byte, error) {
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, ErrNotObject
+	}
+	if hasNull(v) {
+		return nil, errors.New("toml: cannot encode null")
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hasNull(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		for _, e := range x {
+			if hasNull(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range x {
+			if hasNull(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,15 +3,24 @@ package config
 import (
 	"flag"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 var dataDir = flag.String("data-dir", "data", "data directory")
 var jsonCache = flag.Int("json-cache", 100, "json cache size, default 100M")
 var metaCache = flag.Int("meta-cache", 1024, "meta cache limit, default 1024")
+var historySize = flag.Int("history", 10, "number of prior revisions kept for each document, 0 to disable")
 var defaultAccess = flag.String("default-access", "protected", "public/protected/private")
+var idPattern = flag.String("id-pattern", "", "regexp of ids besides UUIDs which clients may choose, empty to allow UUIDs only")
+var backend = flag.String("backend", FileBackend, "file/memory/bolt")
+var sweepInterval = flag.Duration("sweep-interval", time.Minute, "interval of deleting expired documents, 0 to disable")
+var wsOrigins = flag.String("ws-origins", "", "comma separated origins allowed to open WebSockets besides the server itself, * for all")
 
 const (
 	Public    string = "public"    // everyone can read/write
@@ -23,26 +32,82 @@ func ValidateAccess(s string) bool {
 	return s == Public || s == Protected || s == Private
 }
 
+const (
+	FileBackend   string = "file"   // a dir of files for each document
+	MemoryBackend string = "memory" // nothing is persisted, for tests and caches
+	BoltBackend   string = "bolt"   // a bbolt database in the data dir
+)
+
+func ValidateBackend(s string) bool {
+	return s == FileBackend || s == MemoryBackend || s == BoltBackend
+}
+
 type Config struct {
 	DataDir       string
 	JSONCacheSize int
 	MetaCacheSize int
+	HistorySize   int
 	DefaultAccess string
+	IDPattern     *regexp.Regexp // nil if only UUIDs are allowed
+	Backend       string
+	SweepInterval time.Duration
+	WSOrigins     []string // cross-site origins allowed to open WebSockets
 }
 
-func NewConfig() *Config {
+func NewConfig() (*Config, error) {
 	flag.Parse()
 
 	if !ValidateAccess(*defaultAccess) {
 		*defaultAccess = Protected
 	}
+	idRegexp, err := CompileIDPattern(*idPattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid id-pattern")
+	}
+	if !ValidateBackend(*backend) {
+		return nil, errors.Errorf("invalid backend %s", *backend)
+	}
 
 	return &Config{
 		DataDir:       *dataDir,
 		JSONCacheSize: *jsonCache,
 		MetaCacheSize: *metaCache,
+		HistorySize:   *historySize,
 		DefaultAccess: *defaultAccess,
+		IDPattern:     idRegexp,
+		Backend:       *backend,
+		SweepInterval: *sweepInterval,
+		WSOrigins:     splitList(*wsOrigins),
+	}, nil
+}
+
+// ValidID reports if a document may be created with the id. UUIDs are
+// always valid, other ids must be well-formed and match IDPattern.
+func (c *Config) ValidID(id string) bool {
+	if util.IsUUID(id) {
+		return true
+	}
+	return c.IDPattern != nil && util.IsID(id) && c.IDPattern.MatchString(id)
+}
+
+// CompileIDPattern compiles the pattern of -id-pattern, which must match whole
+// ids. It returns nil for the empty pattern.
+func CompileIDPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// splitList splits a comma separated flag, dropping empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			list = append(list, x)
+		}
 	}
+	return list
 }
 
 type DataDir string
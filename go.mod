@@ -3,11 +3,17 @@ module github.com/disksing/luson
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/pkg/errors v0.9.1
 	github.com/satori/go.uuid v1.2.0
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.6.1
 	github.com/unrolled/render v1.0.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.etcd.io/bbolt v1.3.6
 	go.uber.org/dig v1.10.0
 	go.uber.org/zap v1.15.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,85 @@
+package jsonp
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// Operation is a JSON Patch operation, see RFC 6902.
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value Any    `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. The value is omitted for remove
+// operations only, since null is a valid value to add.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type op Operation
+	return json.Marshal(op(o))
+}
+
+// Diff returns the JSON Patch which turns x into y.
+func Diff(x, y Any) []Operation {
+	return diffRecr(nil, "", x, y)
+}
+
+func diffRecr(ops []Operation, pointer string, x, y Any) []Operation {
+	if xo, ok := x.(Object); ok {
+		if yo, ok := y.(Object); ok {
+			keys := make([]string, 0, len(xo)+len(yo))
+			for k := range xo {
+				keys = append(keys, k)
+			}
+			for k := range yo {
+				if _, ok := xo[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := pointer + "/" + PointerEscaper.Replace(k)
+				xv, inX := xo[k]
+				yv, inY := yo[k]
+				switch {
+				case !inY:
+					ops = append(ops, Operation{Op: "remove", Path: p})
+				case !inX:
+					ops = append(ops, Operation{Op: "add", Path: p, Value: yv})
+				default:
+					ops = diffRecr(ops, p, xv, yv)
+				}
+			}
+			return ops
+		}
+	}
+	if xa, ok := x.(Array); ok {
+		if ya, ok := y.(Array); ok {
+			n := len(xa)
+			if len(ya) < n {
+				n = len(ya)
+			}
+			for i := 0; i < n; i++ {
+				ops = diffRecr(ops, pointer+"/"+strconv.Itoa(i), xa[i], ya[i])
+			}
+			for i := len(xa) - 1; i >= n; i-- {
+				ops = append(ops, Operation{Op: "remove", Path: pointer + "/" + strconv.Itoa(i)})
+			}
+			for i := n; i < len(ya); i++ {
+				ops = append(ops, Operation{Op: "add", Path: pointer + "/-", Value: ya[i]})
+			}
+			return ops
+		}
+	}
+	if Equal(x, y) {
+		return ops
+	}
+	return append(ops, Operation{Op: "replace", Path: pointer, Value: y})
+}
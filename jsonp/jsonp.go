@@ -2,7 +2,6 @@ package jsonp
 
 import (
 	"io"
-	"reflect"
 	"strconv"
 	"strings"
 
@@ -16,6 +15,10 @@ var (
 	PointerUnescaper = strings.NewReplacer("~0", "~", "~1", "/")
 )
 
+// ErrNotFound is the cause of errors returned when a pointer refers to a node
+// which does not exist.
+var ErrNotFound = errors.New("node not found")
+
 type (
 	// Any represents any JSON node.
 	Any = interface{}
@@ -62,11 +65,24 @@ func Get(x Any, pointer string) (Any, error) {
 	}
 }
 
+// ValidPointer checks the syntax of a pointer.
+func ValidPointer(pointer string) error {
+	t := newTokenizer(pointer)
+	for {
+		if _, err := t.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
 func getChild(x Any, key string) (Any, error) {
 	if obj, ok := x.(Object); ok {
 		o, ok := obj[key]
 		if !ok {
-			return nil, errors.Errorf("no element with key %s", key)
+			return nil, errors.Wrapf(ErrNotFound, "no element with key %s", key)
 		}
 		return o, nil
 	}
@@ -138,6 +154,9 @@ func removeRecr(x Any, t *tokenizer) (Any, Any, error) {
 		return nil, nil, err
 	}
 	if obj, ok := x.(Object); ok {
+		if _, ok := obj[key]; !ok {
+			return nil, nil, errors.Wrapf(ErrNotFound, "no element with key %s", key)
+		}
 		o, r, err := removeRecr(obj[key], t)
 		if err != nil {
 			return nil, nil, err
@@ -252,7 +271,7 @@ func Test(x Any, pointer string, v Any) error {
 	if err != nil {
 		return err
 	}
-	if !reflect.DeepEqual(x, v) {
+	if !Equal(x, v) {
 		return errors.Errorf("test fail, value of %s is %v, expect value is %v", pointer, x, v)
 	}
 	return nil
@@ -330,7 +349,7 @@ func parseIndex(arr Array, str string, allowAppend bool) (idx int, err error) {
 		}
 	}
 	if idx < 0 || idx > len(arr) || (idx == len(arr) && !allowAppend) {
-		return 0, errors.Errorf("index '%v' out of range '%v'", idx, len(arr))
+		return 0, errors.Wrapf(ErrNotFound, "index '%v' out of range '%v'", idx, len(arr))
 	}
 	return idx, nil
 }
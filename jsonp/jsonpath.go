@@ -0,0 +1,1132 @@
+package jsonp
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Query is a compiled JSONPath query, see RFC 9535. It supports name, index,
+// slice, wildcard and filter selectors, descendant segments and the standard
+// function extensions length, count, match, search and value.
+type Query struct {
+	q *pathQuery
+}
+
+// Node is a node selected by a query.
+type Node struct {
+	Value Any
+	loc   *location
+}
+
+// location is the position of a node, as a list from the node to the root.
+type location struct {
+	parent *location
+	name   string
+	index  int // -1 for object members
+}
+
+// Path returns the normalized path of the node, for example `$['a'][0]`.
+func (n Node) Path() string {
+	var sb strings.Builder
+	sb.WriteByte('$')
+	for _, l := range n.locations() {
+		if l.index >= 0 {
+			sb.WriteString("[" + strconv.Itoa(l.index) + "]")
+			continue
+		}
+		sb.WriteString("['")
+		for _, r := range l.name {
+			switch r {
+			case '\b':
+				sb.WriteString(`\b`)
+			case '\f':
+				sb.WriteString(`\f`)
+			case '\n':
+				sb.WriteString(`\n`)
+			case '\r':
+				sb.WriteString(`\r`)
+			case '\t':
+				sb.WriteString(`\t`)
+			case '\'':
+				sb.WriteString(`\'`)
+			case '\\':
+				sb.WriteString(`\\`)
+			default:
+				if r < 0x20 {
+					fmt.Fprintf(&sb, `\u%04x`, r)
+				} else {
+					sb.WriteRune(r)
+				}
+			}
+		}
+		sb.WriteString("']")
+	}
+	return sb.String()
+}
+
+// Pointer returns the JSON pointer of the node.
+func (n Node) Pointer() string {
+	var sb strings.Builder
+	for _, l := range n.locations() {
+		sb.WriteByte('/')
+		if l.index >= 0 {
+			sb.WriteString(strconv.Itoa(l.index))
+		} else {
+			sb.WriteString(PointerEscaper.Replace(l.name))
+		}
+	}
+	return sb.String()
+}
+
+func (n Node) locations() []*location {
+	var locs []*location
+	for l := n.loc; l != nil; l = l.parent {
+		locs = append(locs, l)
+	}
+	for i, j := 0, len(locs)-1; i < j; i, j = i+1, j-1 {
+		locs[i], locs[j] = locs[j], locs[i]
+	}
+	return locs
+}
+
+func (n Node) member(name string, v Any) Node {
+	return Node{Value: v, loc: &location{parent: n.loc, name: name, index: -1}}
+}
+
+func (n Node) element(i int, v Any) Node {
+	return Node{Value: v, loc: &location{parent: n.loc, index: i}}
+}
+
+// children returns the children of a node, in index order for arrays and in
+// key order for objects.
+func (n Node) children() []Node {
+	switch x := n.Value.(type) {
+	case Array:
+		nodes := make([]Node, 0, len(x))
+		for i, v := range x {
+			nodes = append(nodes, n.element(i, v))
+		}
+		return nodes
+	case Object:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		nodes := make([]Node, 0, len(x))
+		for _, k := range keys {
+			nodes = append(nodes, n.member(k, x[k]))
+		}
+		return nodes
+	}
+	return nil
+}
+
+// ParseQuery compiles a JSONPath query.
+func ParseQuery(s string) (*Query, error) {
+	var q *pathQuery
+	err := parse(s, func(p *parser) {
+		if p.peek() != '$' {
+			p.fail("expected '$'")
+		}
+		q = p.query()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Query{q: q}, nil
+}
+
+// Filter is a compiled JSONPath filter expression, such as `@.price > 10`.
+type Filter struct {
+	expr logicalExpr
+}
+
+// ParseFilter compiles a filter expression, the part of a filter selector
+// after `?`.
+func ParseFilter(s string) (*Filter, error) {
+	var f Filter
+	err := parse(s, func(p *parser) {
+		f.expr = p.logicalOr()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Match reports whether x passes the filter, with `@` referring to x and `$`
+// to root.
+func (f *Filter) Match(root, x Any) bool {
+	return f.expr.test(&evalCtx{root: root}, x)
+}
+
+// parse runs fn to parse the whole of s.
+func parse(s string, fn func(p *parser)) (err error) {
+	p := &parser{s: s}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(syntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = e.error
+		}
+	}()
+	fn(p)
+	if p.i != len(s) {
+		p.fail("unexpected %q", p.s[p.i:])
+	}
+	return nil
+}
+
+// Select returns the nodes selected by the query in x. Members of objects are
+// visited in key order.
+func (q *Query) Select(x Any) []Node {
+	return q.q.eval(&evalCtx{root: x}, x)
+}
+
+// Values returns the values of the nodes selected by the query in x.
+func (q *Query) Values(x Any) []Any {
+	nodes := q.Select(x)
+	vs := make([]Any, 0, len(nodes))
+	for _, n := range nodes {
+		vs = append(vs, n.Value)
+	}
+	return vs
+}
+
+type evalCtx struct {
+	root Any
+}
+
+type pathQuery struct {
+	relative bool // starts with `@`
+	segments []*segment
+}
+
+func (q *pathQuery) eval(c *evalCtx, cur Any) []Node {
+	nodes := []Node{{Value: cur}}
+	if !q.relative {
+		nodes[0].Value = c.root
+	}
+	for _, seg := range q.segments {
+		var out []Node
+		for _, n := range nodes {
+			out = seg.apply(c, n, out)
+		}
+		nodes = out
+		if len(nodes) == 0 {
+			break
+		}
+	}
+	return nodes
+}
+
+// singular reports whether the query selects at most one node.
+func (q *pathQuery) singular() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		switch seg.selectors[0].(type) {
+		case nameSelector, indexSelector:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+func (s *segment) apply(c *evalCtx, n Node, out []Node) []Node {
+	for _, sel := range s.selectors {
+		out = sel.apply(c, n, out)
+	}
+	if s.descendant {
+		for _, child := range n.children() {
+			out = s.apply(c, child, out)
+		}
+	}
+	return out
+}
+
+type selector interface {
+	apply(c *evalCtx, n Node, out []Node) []Node
+}
+
+type nameSelector string
+
+func (s nameSelector) apply(c *evalCtx, n Node, out []Node) []Node {
+	if obj, ok := n.Value.(Object); ok {
+		if v, ok := obj[string(s)]; ok {
+			out = append(out, n.member(string(s), v))
+		}
+	}
+	return out
+}
+
+type wildcardSelector struct{}
+
+func (wildcardSelector) apply(c *evalCtx, n Node, out []Node) []Node {
+	return append(out, n.children()...)
+}
+
+type indexSelector int
+
+func (s indexSelector) apply(c *evalCtx, n Node, out []Node) []Node {
+	if arr, ok := n.Value.(Array); ok {
+		i := int(s)
+		if i < 0 {
+			i += len(arr)
+		}
+		if i >= 0 && i < len(arr) {
+			out = append(out, n.element(i, arr[i]))
+		}
+	}
+	return out
+}
+
+type sliceSelector struct {
+	start, end       int
+	hasStart, hasEnd bool
+	step             int
+}
+
+func (s sliceSelector) apply(c *evalCtx, n Node, out []Node) []Node {
+	arr, ok := n.Value.(Array)
+	if !ok || s.step == 0 {
+		return out
+	}
+	l := len(arr)
+	normalize := func(i int) int {
+		if i < 0 {
+			return l + i
+		}
+		return i
+	}
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+	if s.step > 0 {
+		start, end := 0, l
+		if s.hasStart {
+			start = clamp(normalize(s.start), 0, l)
+		}
+		if s.hasEnd {
+			end = clamp(normalize(s.end), 0, l)
+		}
+		for i := start; i < end; i += s.step {
+			out = append(out, n.element(i, arr[i]))
+		}
+		return out
+	}
+	start, end := l-1, -1
+	if s.hasStart {
+		start = clamp(normalize(s.start), -1, l-1)
+	}
+	if s.hasEnd {
+		end = clamp(normalize(s.end), -1, l-1)
+	}
+	for i := start; i > end; i += s.step {
+		out = append(out, n.element(i, arr[i]))
+	}
+	return out
+}
+
+type filterSelector struct {
+	expr logicalExpr
+}
+
+func (s filterSelector) apply(c *evalCtx, n Node, out []Node) []Node {
+	for _, child := range n.children() {
+		if s.expr.test(c, child.Value) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// logicalExpr is an expression of LogicalType.
+type logicalExpr interface {
+	test(c *evalCtx, cur Any) bool
+}
+
+// valueExpr is an expression of ValueType. The result is Nothing if ok is
+// false.
+type valueExpr interface {
+	value(c *evalCtx, cur Any) (v Any, ok bool)
+}
+
+type orExpr []logicalExpr
+
+func (e orExpr) test(c *evalCtx, cur Any) bool {
+	for _, x := range e {
+		if x.test(c, cur) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr []logicalExpr
+
+func (e andExpr) test(c *evalCtx, cur Any) bool {
+	for _, x := range e {
+		if !x.test(c, cur) {
+			return false
+		}
+	}
+	return true
+}
+
+type notExpr struct {
+	expr logicalExpr
+}
+
+func (e notExpr) test(c *evalCtx, cur Any) bool {
+	return !e.expr.test(c, cur)
+}
+
+// existExpr tests if a query selects any node.
+type existExpr struct {
+	q *pathQuery
+}
+
+func (e existExpr) test(c *evalCtx, cur Any) bool {
+	return len(e.q.eval(c, cur)) > 0
+}
+
+type literal struct {
+	v Any
+}
+
+func (e literal) value(c *evalCtx, cur Any) (Any, bool) {
+	return e.v, true
+}
+
+type singularQuery struct {
+	q *pathQuery
+}
+
+func (e singularQuery) value(c *evalCtx, cur Any) (Any, bool) {
+	nodes := e.q.eval(c, cur)
+	if len(nodes) != 1 {
+		return nil, false
+	}
+	return nodes[0].Value, true
+}
+
+type compareExpr struct {
+	op          string
+	left, right valueExpr
+}
+
+func (e compareExpr) test(c *evalCtx, cur Any) bool {
+	a, aok := e.left.value(c, cur)
+	b, bok := e.right.value(c, cur)
+	switch e.op {
+	case "==":
+		return equalValue(a, aok, b, bok)
+	case "!=":
+		return !equalValue(a, aok, b, bok)
+	case "<":
+		return lessValue(a, aok, b, bok)
+	case "<=":
+		return lessValue(a, aok, b, bok) || equalValue(a, aok, b, bok)
+	case ">":
+		return lessValue(b, bok, a, aok)
+	default: // ">="
+		return lessValue(b, bok, a, aok) || equalValue(a, aok, b, bok)
+	}
+}
+
+func equalValue(a Any, aok bool, b Any, bok bool) bool {
+	if !aok || !bok {
+		return aok == bok
+	}
+	return Equal(a, b)
+}
+
+func lessValue(a Any, aok bool, b Any, bok bool) bool {
+	if !aok || !bok {
+		return false
+	}
+	if x, ok := Number(a); ok {
+		y, ok := Number(b)
+		return ok && x.Cmp(y) < 0
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		// Byte order of UTF-8 is the order of code points.
+		return ok && x < y
+	}
+	return false
+}
+
+type argType int
+
+const (
+	valueType argType = iota
+	logicalType
+	nodesType
+)
+
+type function struct {
+	params []argType
+	result argType
+}
+
+var functions = map[string]function{
+	"length": {params: []argType{valueType}, result: valueType},
+	"count":  {params: []argType{nodesType}, result: valueType},
+	"match":  {params: []argType{valueType, valueType}, result: logicalType},
+	"search": {params: []argType{valueType, valueType}, result: logicalType},
+	"value":  {params: []argType{nodesType}, result: valueType},
+}
+
+// funcCall is a call of a function extension. Args are valueExpr or
+// *pathQuery, by the types of the parameters.
+type funcCall struct {
+	name string
+	args []interface{}
+	re   *regexp.Regexp // compiled literal pattern of match and search
+	bad  bool           // the literal pattern is invalid
+}
+
+func (f *funcCall) value(c *evalCtx, cur Any) (Any, bool) {
+	switch f.name {
+	case "length":
+		v, ok := f.args[0].(valueExpr).value(c, cur)
+		if !ok {
+			return nil, false
+		}
+		switch x := v.(type) {
+		case string:
+			return intNumber(utf8.RuneCountInString(x)), true
+		case Array:
+			return intNumber(len(x)), true
+		case Object:
+			return intNumber(len(x)), true
+		}
+		return nil, false
+	case "count":
+		return intNumber(len(f.args[0].(*pathQuery).eval(c, cur))), true
+	default: // "value"
+		nodes := f.args[0].(*pathQuery).eval(c, cur)
+		if len(nodes) != 1 {
+			return nil, false
+		}
+		return nodes[0].Value, true
+	}
+}
+
+func (f *funcCall) test(c *evalCtx, cur Any) bool {
+	v, ok := f.args[0].(valueExpr).value(c, cur)
+	s, isStr := v.(string)
+	if !ok || !isStr || f.bad {
+		return false
+	}
+	re := f.re
+	if re == nil {
+		v, ok := f.args[1].(valueExpr).value(c, cur)
+		pattern, isStr := v.(string)
+		if !ok || !isStr {
+			return false
+		}
+		var err error
+		if re, err = compileIRegexp(pattern, f.name == "match"); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(s)
+}
+
+func intNumber(i int) json.Number {
+	return json.Number(strconv.Itoa(i))
+}
+
+// compileIRegexp compiles an I-Regexp (RFC 9485). `.` does not match line
+// breaks, and full patterns must match the whole string.
+func compileIRegexp(pattern string, full bool) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			sb.WriteByte(c)
+			i++
+			c = pattern[i]
+		case c == '[' && !inClass:
+			inClass = true
+		case c == ']' && inClass:
+			inClass = false
+		case c == '.' && !inClass:
+			sb.WriteString(`[^\n\r]`)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	if full {
+		return regexp.Compile(`\A(?:` + sb.String() + `)\z`)
+	}
+	return regexp.Compile(sb.String())
+}
+
+// maxNesting limits nested expressions of queries.
+const maxNesting = 64
+
+// maxExponent is the largest exponent of number literals, beyond the range
+// of float64.
+const maxExponent = 400
+
+// maxIndex is the largest exact integer of I-JSON.
+const maxIndex = 1<<53 - 1
+
+type syntaxError struct {
+	error
+}
+
+type parser struct {
+	s     string
+	i     int
+	depth int
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(syntaxError{errors.Errorf("invalid jsonpath at %d: "+format, append([]interface{}{p.i}, args...)...)})
+}
+
+func (p *parser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) enter() {
+	p.depth++
+	if p.depth > maxNesting {
+		p.fail("too deeply nested")
+	}
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// query parses a query starting with `$` or `@`.
+func (p *parser) query() *pathQuery {
+	q := &pathQuery{relative: p.peek() == '@'}
+	p.i++
+	for {
+		save := p.i
+		p.skipSpace()
+		seg := p.segment()
+		if seg == nil {
+			p.i = save
+			return q
+		}
+		q.segments = append(q.segments, seg)
+	}
+}
+
+func (p *parser) segment() *segment {
+	switch {
+	case strings.HasPrefix(p.s[p.i:], ".."):
+		p.i += 2
+		seg := &segment{descendant: true}
+		switch c := p.peek(); {
+		case c == '[':
+			seg.selectors = p.bracketed()
+		case c == '*':
+			p.i++
+			seg.selectors = []selector{wildcardSelector{}}
+		default:
+			seg.selectors = []selector{nameSelector(p.memberName())}
+		}
+		return seg
+	case p.peek() == '.':
+		p.i++
+		if p.peek() == '*' {
+			p.i++
+			return &segment{selectors: []selector{wildcardSelector{}}}
+		}
+		return &segment{selectors: []selector{nameSelector(p.memberName())}}
+	case p.peek() == '[':
+		return &segment{selectors: p.bracketed()}
+	}
+	return nil
+}
+
+func isNameFirst(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r >= 0x80
+}
+
+func (p *parser) memberName() string {
+	start := p.i
+	for p.i < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.i:])
+		if r == utf8.RuneError && size == 1 {
+			p.fail("invalid UTF-8")
+		}
+		if !isNameFirst(r) && !(r >= '0' && r <= '9' && p.i > start) {
+			break
+		}
+		p.i += size
+	}
+	if p.i == start {
+		p.fail("expected member name")
+	}
+	return p.s[start:p.i]
+}
+
+func (p *parser) bracketed() []selector {
+	p.i++ // '['
+	var sels []selector
+	for {
+		p.skipSpace()
+		sels = append(sels, p.selector())
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.i++
+		case ']':
+			p.i++
+			return sels
+		default:
+			p.fail("expected ',' or ']'")
+		}
+	}
+}
+
+func (p *parser) selector() selector {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		return nameSelector(p.stringLiteral())
+	case c == '*':
+		p.i++
+		return wildcardSelector{}
+	case c == '?':
+		p.i++
+		p.skipSpace()
+		return filterSelector{expr: p.logicalOr()}
+	case c == '-' || c == ':' || c >= '0' && c <= '9':
+		return p.indexOrSlice()
+	}
+	p.fail("expected selector")
+	return nil
+}
+
+func (p *parser) indexOrSlice() selector {
+	var s sliceSelector
+	s.start, s.hasStart = p.optInt()
+	save := p.i
+	p.skipSpace()
+	if p.peek() != ':' {
+		if !s.hasStart {
+			p.fail("expected index")
+		}
+		p.i = save
+		return indexSelector(s.start)
+	}
+	p.i++
+	p.skipSpace()
+	s.end, s.hasEnd = p.optInt()
+	save = p.i
+	p.skipSpace()
+	s.step = 1
+	if p.peek() == ':' {
+		p.i++
+		p.skipSpace()
+		if step, ok := p.optInt(); ok {
+			s.step = step
+		}
+	} else {
+		p.i = save
+	}
+	return s
+}
+
+// optInt parses an integer if there is one.
+func (p *parser) optInt() (int, bool) {
+	start := p.i
+	if p.peek() == '-' {
+		p.i++
+	}
+	digits := p.i
+	for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+		p.i++
+	}
+	if p.i == start {
+		return 0, false
+	}
+	s := p.s[start:p.i]
+	if p.i == digits || (p.s[digits] == '0' && (p.i-digits > 1 || digits > start)) {
+		p.fail("invalid integer %s", s)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n > maxIndex || n < -maxIndex {
+		p.fail("integer out of range %s", s)
+	}
+	return int(n), true
+}
+
+func (p *parser) stringLiteral() string {
+	quote := p.s[p.i]
+	p.i++
+	var sb strings.Builder
+	for {
+		if p.i >= len(p.s) {
+			p.fail("unterminated string")
+		}
+		c := p.s[p.i]
+		switch {
+		case c == quote:
+			p.i++
+			return sb.String()
+		case c < 0x20:
+			p.fail("control character in string")
+		case c == '\\':
+			p.i++
+			sb.WriteRune(p.escape(quote))
+		default:
+			r, size := utf8.DecodeRuneInString(p.s[p.i:])
+			if r == utf8.RuneError && size == 1 {
+				p.fail("invalid UTF-8")
+			}
+			sb.WriteString(p.s[p.i : p.i+size])
+			p.i += size
+		}
+	}
+}
+
+func (p *parser) escape(quote byte) rune {
+	c := p.peek()
+	p.i++
+	switch c {
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case '/', '\\', quote:
+		return rune(c)
+	case 'u':
+		r := p.hex4()
+		if r >= 0xDC00 && r <= 0xDFFF {
+			p.fail("unpaired surrogate")
+		}
+		if r >= 0xD800 && r <= 0xDBFF {
+			if !strings.HasPrefix(p.s[p.i:], `\u`) {
+				p.fail("unpaired surrogate")
+			}
+			p.i += 2
+			r2 := p.hex4()
+			if r2 < 0xDC00 || r2 > 0xDFFF {
+				p.fail("unpaired surrogate")
+			}
+			r = 0x10000 + (r-0xD800)<<10 + (r2 - 0xDC00)
+		}
+		return r
+	}
+	p.i--
+	p.fail("invalid escape")
+	return 0
+}
+
+func (p *parser) hex4() rune {
+	if p.i+4 > len(p.s) {
+		p.fail("invalid unicode escape")
+	}
+	n, err := strconv.ParseUint(p.s[p.i:p.i+4], 16, 32)
+	if err != nil {
+		p.fail("invalid unicode escape")
+	}
+	p.i += 4
+	return rune(n)
+}
+
+func (p *parser) logicalOr() logicalExpr {
+	es := orExpr{p.logicalAnd()}
+	for {
+		save := p.i
+		p.skipSpace()
+		if !strings.HasPrefix(p.s[p.i:], "||") {
+			p.i = save
+			break
+		}
+		p.i += 2
+		p.skipSpace()
+		es = append(es, p.logicalAnd())
+	}
+	if len(es) == 1 {
+		return es[0]
+	}
+	return es
+}
+
+func (p *parser) logicalAnd() logicalExpr {
+	es := andExpr{p.basic()}
+	for {
+		save := p.i
+		p.skipSpace()
+		if !strings.HasPrefix(p.s[p.i:], "&&") {
+			p.i = save
+			break
+		}
+		p.i += 2
+		p.skipSpace()
+		es = append(es, p.basic())
+	}
+	if len(es) == 1 {
+		return es[0]
+	}
+	return es
+}
+
+func (p *parser) basic() logicalExpr {
+	p.enter()
+	defer p.leave()
+	switch p.peek() {
+	case '!':
+		p.i++
+		p.skipSpace()
+		if p.peek() == '(' {
+			return notExpr{p.paren()}
+		}
+		return notExpr{p.asTest(p.operand())}
+	case '(':
+		return p.paren()
+	}
+	left := p.operand()
+	save := p.i
+	p.skipSpace()
+	op := p.compareOp()
+	if op == "" {
+		p.i = save
+		return p.asTest(left)
+	}
+	p.skipSpace()
+	right := p.operand()
+	return compareExpr{op: op, left: p.asValue(left), right: p.asValue(right)}
+}
+
+func (p *parser) paren() logicalExpr {
+	p.i++ // '('
+	p.skipSpace()
+	e := p.logicalOr()
+	p.skipSpace()
+	if p.peek() != ')' {
+		p.fail("expected ')'")
+	}
+	p.i++
+	return e
+}
+
+var compareOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *parser) compareOp() string {
+	for _, op := range compareOps {
+		if strings.HasPrefix(p.s[p.i:], op) {
+			p.i += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+// operand parses a literal, a query or a function call.
+func (p *parser) operand() interface{} {
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		return p.query()
+	case c == '\'' || c == '"':
+		return literal{p.stringLiteral()}
+	case c == '-' || c >= '0' && c <= '9':
+		return literal{p.number()}
+	case c >= 'a' && c <= 'z':
+		start := p.i
+		for p.i < len(p.s) {
+			c := p.s[p.i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+				break
+			}
+			p.i++
+		}
+		name := p.s[start:p.i]
+		if p.peek() == '(' {
+			p.i = start
+			return p.funcCall(name)
+		}
+		switch name {
+		case "true":
+			return literal{true}
+		case "false":
+			return literal{false}
+		case "null":
+			return literal{nil}
+		}
+		p.i = start
+		p.fail("unexpected %s", name)
+	}
+	p.fail("expected literal, query or function")
+	return nil
+}
+
+func (p *parser) number() json.Number {
+	start := p.i
+	if p.peek() == '-' {
+		p.i++
+	}
+	digits := p.i
+	for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+		p.i++
+	}
+	if p.i == digits || (p.s[digits] == '0' && p.i-digits > 1) {
+		p.fail("invalid number")
+	}
+	if p.peek() == '.' {
+		p.i++
+		frac := p.i
+		for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		if p.i == frac {
+			p.fail("invalid number")
+		}
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		p.i++
+		if c := p.peek(); c == '+' || c == '-' {
+			p.i++
+		}
+		exp := p.i
+		for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		if p.i == exp {
+			p.fail("invalid number")
+		}
+		// Exact numbers with huge exponents are too expensive to compare.
+		if n, err := strconv.Atoi(p.s[exp:p.i]); err != nil || n > maxExponent {
+			p.fail("number out of range")
+		}
+	}
+	return json.Number(p.s[start:p.i])
+}
+
+func (p *parser) funcCall(name string) *funcCall {
+	fn, ok := functions[name]
+	if !ok {
+		p.fail("unknown function %s", name)
+	}
+	p.enter()
+	defer p.leave()
+	p.i += len(name) + 1
+	f := &funcCall{name: name}
+	for i, param := range fn.params {
+		p.skipSpace()
+		if i > 0 {
+			if p.peek() != ',' {
+				p.fail("expected ','")
+			}
+			p.i++
+			p.skipSpace()
+		}
+		arg := p.operand()
+		if param == nodesType {
+			q, ok := arg.(*pathQuery)
+			if !ok {
+				p.fail("%s expects a query argument", name)
+			}
+			f.args = append(f.args, q)
+		} else {
+			f.args = append(f.args, p.asValue(arg))
+		}
+	}
+	p.skipSpace()
+	if p.peek() != ')' {
+		p.fail("expected ')'")
+	}
+	p.i++
+	if fn.result == logicalType {
+		if lit, ok := f.args[1].(literal); ok {
+			pattern, ok := lit.v.(string)
+			var err error
+			if ok {
+				f.re, err = compileIRegexp(pattern, name == "match")
+			}
+			f.bad = !ok || err != nil
+		}
+	}
+	return f
+}
+
+// asValue checks that an operand is of ValueType.
+func (p *parser) asValue(o interface{}) valueExpr {
+	switch x := o.(type) {
+	case literal:
+		return x
+	case *pathQuery:
+		if !x.singular() {
+			p.fail("non-singular query in comparison")
+		}
+		return singularQuery{x}
+	case *funcCall:
+		if functions[x.name].result != valueType {
+			p.fail("%s does not return a value", x.name)
+		}
+		return x
+	}
+	panic("unreachable")
+}
+
+// asTest checks that an operand can be a test expression.
+func (p *parser) asTest(o interface{}) logicalExpr {
+	switch x := o.(type) {
+	case *pathQuery:
+		return existExpr{x}
+	case *funcCall:
+		if functions[x.name].result != logicalType {
+			p.fail("result of %s must be compared", x.name)
+		}
+		return x
+	}
+	p.fail("literal is not a test")
+	return nil
+}
@@ -0,0 +1,76 @@
+package jsonp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Unmarshal parses JSON data like json.Unmarshal, except that numbers are
+// decoded into json.Number to keep them exact.
+func Unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// Equal reports whether two nodes are equal. Numbers are equal if they have
+// the same value, regardless of their representation, for example `1` and
+// `1.0`.
+func Equal(x, y Any) bool {
+	switch a := x.(type) {
+	case Object:
+		b, ok := y.(Object)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case Array:
+		b, ok := y.(Array)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !Equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if a, ok := Number(x); ok {
+		b, ok := Number(y)
+		return ok && a.Cmp(b) == 0
+	}
+	return x == y
+}
+
+// Number converts a number node, either json.Number or float64, to an exact
+// rational.
+func Number(x Any) (*big.Rat, bool) {
+	switch n := x.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(n))
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(n), true
+	}
+	return nil, false
+}
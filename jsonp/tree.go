@@ -0,0 +1,221 @@
+package jsonp
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Tree is an immutable JSON node. Updates return a new tree which copies
+// only the objects and arrays on the path from the root to the changed node,
+// and shares all the others with the old tree. So a small change to a large
+// document does not copy the document, and the old tree stays valid for
+// readers holding it. A copy still costs the number of children of the
+// node, so wide objects on the path are the expensive part of an update.
+//
+// A tree is made of ordinary Objects and Arrays, which makes converting from
+// and to Any free. Nodes in the tree, including the values passed in, must
+// not be modified afterwards.
+type Tree struct {
+	root Any
+}
+
+// NewTree makes a tree of a node. The node is shared, not copied.
+func NewTree(x Any) Tree {
+	return Tree{root: x}
+}
+
+// Value returns the root node of the tree.
+func (t Tree) Value() Any {
+	return t.root
+}
+
+// Get returns child node of the tree.
+func (t Tree) Get(pointer string) (Any, error) {
+	return Get(t.root, pointer)
+}
+
+// Add adds a node to the tree by pointer.
+func (t Tree) Add(pointer string, v Any) (Tree, error) {
+	if pointer == "" {
+		return Tree{root: v}, nil
+	}
+	root, err := edit(t.root, newTokenizer(pointer), func(x Any, key string, t *tokenizer) (Any, error) {
+		if obj, ok := x.(Object); ok {
+			obj = copyObject(obj, 1)
+			obj[key] = v
+			return obj, nil
+		}
+		if arr, ok := x.(Array); ok {
+			idx, err := parseIndex(arr, key, true)
+			if err != nil {
+				return nil, errors.Wrap(err, "path:"+t.pointer)
+			}
+			arr2 := make(Array, 0, len(arr)+1)
+			arr2 = append(arr2, arr[:idx]...)
+			arr2 = append(arr2, v)
+			return append(arr2, arr[idx:]...), nil
+		}
+		return nil, errors.Errorf("node is not array or object")
+	})
+	return Tree{root: root}, err
+}
+
+// Remove removes child of the tree, and returns the removed node.
+func (t Tree) Remove(pointer string) (Tree, Any, error) {
+	if pointer == "" {
+		return Tree{}, t.root, nil
+	}
+	var removed Any
+	root, err := edit(t.root, newTokenizer(pointer), func(x Any, key string, t *tokenizer) (Any, error) {
+		if obj, ok := x.(Object); ok {
+			v, ok := obj[key]
+			if !ok {
+				return nil, errors.Wrapf(ErrNotFound, "no element with key %s", key)
+			}
+			removed = v
+			obj = copyObject(obj, 0)
+			delete(obj, key)
+			return obj, nil
+		}
+		if arr, ok := x.(Array); ok {
+			idx, err := parseIndex(arr, key, false)
+			if err != nil {
+				return nil, errors.Wrap(err, "path:"+t.pointer)
+			}
+			removed = arr[idx]
+			arr2 := make(Array, 0, len(arr)-1)
+			arr2 = append(arr2, arr[:idx]...)
+			return append(arr2, arr[idx+1:]...), nil
+		}
+		return nil, errors.Errorf("node is not array or object")
+	})
+	if err != nil {
+		return Tree{}, nil, err
+	}
+	return Tree{root: root}, removed, nil
+}
+
+// Replace replaces child of the tree with another.
+func (t Tree) Replace(pointer string, v Any) (Tree, error) {
+	if pointer == "" {
+		return Tree{root: v}, nil
+	}
+	root, err := edit(t.root, newTokenizer(pointer), func(x Any, key string, t *tokenizer) (Any, error) {
+		if obj, ok := x.(Object); ok {
+			obj = copyObject(obj, 0)
+			obj[key] = v
+			return obj, nil
+		}
+		if arr, ok := x.(Array); ok {
+			idx, err := parseIndex(arr, key, false)
+			if err != nil {
+				return nil, errors.Wrap(err, "path:"+t.pointer)
+			}
+			arr = copyArray(arr)
+			arr[idx] = v
+			return arr, nil
+		}
+		return nil, errors.Errorf("node is not array or object")
+	})
+	return Tree{root: root}, err
+}
+
+// Move moves a child to another place.
+func (t Tree) Move(from, to string) (Tree, error) {
+	t, v, err := t.Remove(from)
+	if err != nil {
+		return Tree{}, err
+	}
+	return t.Add(to, v)
+}
+
+// Copy copies a child node to another place. The node is shared by both
+// places instead of being copied.
+func (t Tree) Copy(from, to string) (Tree, error) {
+	v, err := t.Get(from)
+	if err != nil {
+		return Tree{}, err
+	}
+	return t.Add(to, v)
+}
+
+// Merge merges a node into child of the tree, see Merge. Only the objects
+// changed by the merge are copied.
+func (t Tree) Merge(pointer string, v Any) (Tree, error) {
+	x, err := t.Get(pointer)
+	if err != nil {
+		return Tree{}, err
+	}
+	return t.Replace(pointer, merged(x, v))
+}
+
+// edit returns a copy of x in which the parent of the node referred by the
+// pointer is replaced by fn. Nodes on the way are copied, the others are
+// shared. The pointer must not be empty.
+func edit(x Any, t *tokenizer, fn func(x Any, key string, t *tokenizer) (Any, error)) (Any, error) {
+	key, err := t.Next()
+	if err != nil {
+		return nil, err
+	}
+	if !t.More() {
+		return fn(x, key, t)
+	}
+	if obj, ok := x.(Object); ok {
+		child, ok := obj[key]
+		if !ok {
+			return nil, errors.Wrapf(ErrNotFound, "no element with key %s", key)
+		}
+		child, err = edit(child, t, fn)
+		if err != nil {
+			return nil, err
+		}
+		obj = copyObject(obj, 0)
+		obj[key] = child
+		return obj, nil
+	}
+	if arr, ok := x.(Array); ok {
+		idx, err := parseIndex(arr, key, false)
+		if err != nil {
+			return nil, errors.Wrap(err, "path:"+t.pointer)
+		}
+		child, err := edit(arr[idx], t, fn)
+		if err != nil {
+			return nil, err
+		}
+		arr = copyArray(arr)
+		arr[idx] = child
+		return arr, nil
+	}
+	return nil, errors.Errorf("node is not array or object")
+}
+
+// merged is Merge without modifying x.
+func merged(x, v Any) Any {
+	vo, ok := v.(Object)
+	if !ok {
+		return v
+	}
+	xo, _ := x.(Object)
+	obj := copyObject(xo, len(vo))
+	for k, v := range vo {
+		if v == nil {
+			delete(obj, k)
+		} else {
+			obj[k] = merged(xo[k], v)
+		}
+	}
+	return obj
+}
+
+// copyObject makes a shallow copy of an object, with room for n more keys.
+func copyObject(obj Object, n int) Object {
+	obj2 := make(Object, len(obj)+n)
+	for k, v := range obj {
+		obj2[k] = v
+	}
+	return obj2
+}
+
+// copyArray makes a shallow copy of an array.
+func copyArray(arr Array) Array {
+	return append(make(Array, 0, len(arr)), arr...)
+}
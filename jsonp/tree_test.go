@@ -0,0 +1,120 @@
+package jsonp
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeUpdates(t *testing.T) {
+	r := require.New(t)
+	var x Any
+	r.Nil(Unmarshal([]byte(`{"a":{"b":[1,2,3]},"c":{"d":"e"}}`), &x))
+	before, err := json.Marshal(x)
+	r.Nil(err)
+
+	tree := NewTree(x)
+	cases := []struct {
+		update func() (Tree, error)
+		expect string
+	}{
+		{func() (Tree, error) { return tree.Add("/a/b/1", "x") }, `{"a":{"b":[1,"x",2,3]},"c":{"d":"e"}}`},
+		{func() (Tree, error) { return tree.Add("/a/b/-", "x") }, `{"a":{"b":[1,2,3,"x"]},"c":{"d":"e"}}`},
+		{func() (Tree, error) { return tree.Add("/f", "x") }, `{"a":{"b":[1,2,3]},"c":{"d":"e"},"f":"x"}`},
+		{func() (Tree, error) { t, _, err := tree.Remove("/a/b/0"); return t, err }, `{"a":{"b":[2,3]},"c":{"d":"e"}}`},
+		{func() (Tree, error) { t, _, err := tree.Remove("/c/d"); return t, err }, `{"a":{"b":[1,2,3]},"c":{}}`},
+		{func() (Tree, error) { return tree.Replace("/a/b/2", "x") }, `{"a":{"b":[1,2,"x"]},"c":{"d":"e"}}`},
+		{func() (Tree, error) { return tree.Replace("", "x") }, `"x"`},
+		{func() (Tree, error) { return tree.Move("/c/d", "/a/b/0") }, `{"a":{"b":["e",1,2,3]},"c":{}}`},
+		{func() (Tree, error) { return tree.Copy("/a", "/c/a") }, `{"a":{"b":[1,2,3]},"c":{"a":{"b":[1,2,3]},"d":"e"}}`},
+		{func() (Tree, error) { return tree.Merge("/c", Object{"d": nil, "g": "h"}) }, `{"a":{"b":[1,2,3]},"c":{"g":"h"}}`},
+	}
+	for _, c := range cases {
+		t, err := c.update()
+		r.Nil(err)
+		data, err := json.Marshal(t.Value())
+		r.Nil(err)
+		r.JSONEq(c.expect, string(data))
+	}
+
+	// The original tree is not changed by any of the updates.
+	after, err := json.Marshal(x)
+	r.Nil(err)
+	r.Equal(string(before), string(after))
+
+	_, _, err = tree.Remove("/a/x")
+	r.Equal(ErrNotFound, errors.Cause(err))
+	_, err = tree.Add("/a/b/4", "x")
+	r.Equal(ErrNotFound, errors.Cause(err))
+	_, err = tree.Replace("/c/d/e", "x")
+	r.NotNil(err)
+}
+
+func TestTreeSharesSiblings(t *testing.T) {
+	r := require.New(t)
+	x := Object{"a": Object{"b": Array{1}}, "c": Object{"d": Array{2}}}
+	tree, err := NewTree(x).Add("/a/b/-", 3)
+	r.Nil(err)
+	y := tree.Value().(Object)
+	// Only the path to the change is copied, the sibling is the same node.
+	r.Equal(Array{1}, x["a"].(Object)["b"])
+	r.Equal(Array{1, 3}, y["a"].(Object)["b"])
+	r.True(&x["c"].(Object)["d"].(Array)[0] == &y["c"].(Object)["d"].(Array)[0])
+}
+
+// bigDoc makes an object of n records, about 100 bytes of JSON each.
+func bigDoc(n int) Any {
+	obj := make(Object, n)
+	for i := 0; i < n; i++ {
+		obj["k"+strconv.Itoa(i)] = Object{
+			"id":   json.Number(strconv.Itoa(i)),
+			"name": "record " + strconv.Itoa(i),
+			"tags": Array{"a", "b", "c"},
+			"pos":  Object{"x": json.Number("1.5"), "y": json.Number("2.5")},
+		}
+	}
+	return obj
+}
+
+func BenchmarkCloneReplace(b *testing.B) {
+	doc := bigDoc(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Replace(Clone(doc), "/k42/pos/x", json.Number("3")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTreeReplace(b *testing.B) {
+	tree := NewTree(bigDoc(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.Replace("/k42/pos/x", json.Number("3")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCloneAdd(b *testing.B) {
+	doc := Object{"items": bigDoc(1000), "log": Array{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Add(Clone(doc), "/items/k42/tags/-", "d"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTreeAdd(b *testing.B) {
+	tree := NewTree(Object{"items": bigDoc(1000), "log": Array{}})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.Add("/items/k42/tags/-", "d"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
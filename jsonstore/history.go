@@ -0,0 +1,166 @@
+package jsonstore
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disksing/luson/backend"
+	"github.com/disksing/luson/jsonp"
+)
+
+// Origin describes the request which produced a revision.
+type Origin struct {
+	Method string `json:"method"`
+	URI    string `json:"uri"`
+}
+
+// Revision is a recorded version of a document. The current version is
+// recorded as well, followed by up to HistorySize prior ones.
+type Revision struct {
+	Version int64       `json:"version"`
+	Hash    string      `json:"hash"`
+	Time    time.Time   `json:"time"`
+	Origin  *Origin     `json:"origin,omitempty"`
+	Value   interface{} `json:"value"`
+}
+
+// History returns the recorded revisions of a document, newest first.
+func (s *Store) History(id string) ([]*Revision, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	vers, err := s.versions(id)
+	if err != nil {
+		return nil, err
+	}
+	revs := make([]*Revision, 0, len(vers))
+	for i := len(vers) - 1; i >= 0; i-- {
+		rev, err := s.readRevision(id, vers[i])
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+// Revision returns the revision of a document with the version number, or
+// nil if it is not recorded.
+func (s *Store) Revision(id string, version int64) (*Revision, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	rev, err := s.readRevision(id, version)
+	if err == backend.ErrNotFound {
+		return nil, nil
+	}
+	return rev, err
+}
+
+// RevisionAt returns the revision of a document which was current at the
+// time, or nil if it is not recorded.
+func (s *Store) RevisionAt(id string, t time.Time) (*Revision, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	vers, err := s.versions(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(vers) - 1; i >= 0; i-- {
+		rev, err := s.readRevision(id, vers[i])
+		if err != nil {
+			return nil, err
+		}
+		if !rev.Time.After(t) {
+			return rev, nil
+		}
+	}
+	return nil, nil
+}
+
+// record returns the writes which save the revision of a newly written
+// document, and drop the one which falls out of the history.
+func (s *Store) record(j *jData, origin *Origin) ([]backend.Op, error) {
+	rev := &Revision{
+		Version: j.version,
+		Hash:    j.hash,
+		Time:    j.lastModify,
+		Origin:  origin,
+		Value:   j.value,
+	}
+	b, err := json.Marshal(rev)
+	if err != nil {
+		return nil, err
+	}
+	return []backend.Op{
+		{Key: revisionKey(j.id, j.version), Data: b},
+		{Key: revisionKey(j.id, j.version-int64(s.historySize)-1)},
+	}, nil
+}
+
+// recover brings the history of a loaded document up to date. The revision
+// of the current version is missing if a crash happened right after the data
+// was written.
+func (s *Store) recover(j *jData) error {
+	vers, err := s.versions(j.id)
+	if err != nil || len(vers) == 0 {
+		return err
+	}
+	top, err := s.readRevision(j.id, vers[len(vers)-1])
+	if err != nil {
+		return err
+	}
+	j.version = top.Version
+	if top.Hash == j.hash {
+		return nil
+	}
+	j.version++
+	s.logger.Warnw("missing revision recorded", "id", j.id, "version", j.version)
+	ops, err := s.record(j, nil)
+	if err != nil {
+		return err
+	}
+	return s.write(ops)
+}
+
+// versions returns the recorded version numbers of a document in ascending
+// order.
+func (s *Store) versions(id string) ([]int64, error) {
+	names, err := s.backend.List(id, historyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	vers := make([]int64, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimPrefix(name, historyPrefix)
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		vers = append(vers, v)
+	}
+	sort.Slice(vers, func(i, j int) bool { return vers[i] < vers[j] })
+	return vers, nil
+}
+
+func (s *Store) readRevision(id string, version int64) (*Revision, error) {
+	b, _, err := s.backend.Load(revisionKey(id, version))
+	if err != nil {
+		return nil, err
+	}
+	var rev Revision
+	if err = jsonp.Unmarshal(b, &rev); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func revisionKey(id string, version int64) backend.Key {
+	return backend.Key{Doc: id, Name: historyPrefix + strconv.FormatInt(version, 10) + ".json"}
+}
+
+const historyPrefix = "history/"
@@ -4,30 +4,51 @@ import (
 	"container/list"
 	"crypto/sha1"
 	"encoding/hex"
-	"encoding/json"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/disksing/luson/backend"
 	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/util"
+	"go.uber.org/zap"
 )
 
 type Store struct {
-	dataDir       string
+	backend       backend.Backend
 	cacheCapacity int64
+	historySize   int
+	logger        *util.Logger
+	// locks are held across the I/O of documents. Transactions lock all
+	// their documents at once, see Stripes.LockAll.
+	locks util.Stripes
 
+	// The mutex guards the cache, it is never held across I/O.
 	sync.Mutex
 	access    *list.List
 	cache     map[string]*list.Element
 	totalSize int64
+	listener  Listener
 }
 
-func NewStore(dataDir config.DataDir, conf *config.Config) *Store {
+// Listener is called with each written or deleted document, in the order of
+// writes of the document. It is called with the document locked, so it must
+// be fast and must not call back into the store.
+type Listener func(id string, v interface{}, info Info, deleted bool)
+
+// SetListener sets the listener of writes.
+func (s *Store) SetListener(l Listener) {
+	s.Lock()
+	defer s.Unlock()
+	s.listener = l
+}
+
+func NewStore(b backend.Backend, conf *config.Config, logger *util.Logger) *Store {
 	return &Store{
-		dataDir:       string(dataDir),
+		backend:       b,
 		cacheCapacity: int64(conf.JSONCacheSize) * 1024 * 1024,
+		historySize:   conf.HistorySize,
+		logger:        logger,
 		access:        list.New(),
 		cache:         make(map[string]*list.Element),
 	}
@@ -39,50 +60,141 @@ type jData struct {
 	hash       string
 	lastModify time.Time
 	size       int64
+	version    int64
 }
 
-func (s *Store) Get(id string) (interface{}, string, error) {
-	s.Lock()
-	defer s.Unlock()
+// Info describes the stored version of a document.
+type Info struct {
+	Version    int64
+	Hash       string
+	LastModify time.Time
+	Size       int64
+}
+
+func (j *jData) info() Info {
+	return Info{Version: j.version, Hash: j.hash, LastModify: j.lastModify, Size: j.size}
+}
+
+// Get returns a document and its stored version. The value is a shared
+// snapshot which must not be modified.
+func (s *Store) Get(id string) (interface{}, Info, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
 	j, err := s.get(id)
 	if err != nil {
-		return nil, "", err
+		return nil, Info{}, err
 	}
-	return j.value, j.hash, nil
+	return j.value, j.info(), nil
 }
 
-func (s *Store) Put(id string, v interface{}) error {
+// Stat returns the stored version of a document. Unlike Get, it does not
+// decode nor cache the document.
+func (s *Store) Stat(id string) (Info, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
 	s.Lock()
-	defer s.Unlock()
-	return s.put(id, v)
+	e, ok := s.cache[id]
+	s.Unlock()
+	if ok {
+		return e.Value.(*jData).info(), nil
+	}
+	b, modTime, err := s.backend.Load(dataKey(id))
+	if err == backend.ErrNotFound {
+		return s.empty(id).info(), nil
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Hash: s.sha1(b), LastModify: modTime, Size: int64(len(b))}, nil
 }
 
+func (s *Store) Put(id string, v interface{}) error {
+	txn := s.NewTxn()
+	txn.Put(id, v)
+	return txn.Commit()
+}
+
+// Delete removes the data of a document.
+func (s *Store) Delete(id string) error {
+	txn := s.NewTxn()
+	txn.Delete(id)
+	return txn.Commit()
+}
+
+// get returns a document, the document must be locked.
 func (s *Store) get(id string) (*jData, error) {
-	if e, ok := s.cache[id]; ok {
+	s.Lock()
+	e, ok := s.cache[id]
+	if ok {
 		s.access.MoveToFront(e)
+	}
+	s.Unlock()
+	if ok {
 		return e.Value.(*jData), nil
 	}
 	j, err := s.load(id)
 	if err != nil {
 		return nil, err
 	}
+	s.Lock()
 	s.in(j)
 	s.evict()
+	s.Unlock()
 	return j, nil
 }
 
-func (s *Store) put(id string, v interface{}) error {
-	if e, ok := s.cache[id]; ok {
-		s.out(e)
+// prepare returns the stored version of a document to be written, and the
+// writes of its data and history.
+func (s *Store) prepare(id string, v interface{}, data []byte, origin *Origin) (*jData, []backend.Op, error) {
+	j := &jData{
+		id:         id,
+		value:      v,
+		hash:       s.sha1(data),
+		lastModify: time.Now(),
+		size:       int64(len(data)),
 	}
-	j, err := s.save(id, v)
-	if err != nil {
-		return err
+	ops := []backend.Op{{Key: dataKey(id), Data: data}}
+	if s.historySize > 0 {
+		cur, err := s.get(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		j.version = cur.version
+		// Rewriting the same content does not produce a new revision.
+		if cur.hash != j.hash {
+			j.version++
+			rec, err := s.record(j, origin)
+			if err != nil {
+				return nil, nil, err
+			}
+			ops = append(ops, rec...)
+		}
+	}
+	return j, ops, nil
+}
+
+// write applies the writes of a document in order.
+func (s *Store) write(ops []backend.Op) error {
+	for _, op := range ops {
+		var err error
+		if op.Data == nil {
+			err = s.backend.Delete(op.Key)
+		} else {
+			err = s.backend.Save(op.Key, op.Data)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	s.in(j)
 	return nil
 }
 
+func (s *Store) uncache(id string) {
+	if e, ok := s.cache[id]; ok {
+		s.out(e)
+	}
+}
+
 func (s *Store) evict() {
 	for s.totalSize > s.cacheCapacity {
 		s.out(s.access.Back())
@@ -90,6 +202,7 @@ func (s *Store) evict() {
 }
 
 func (s *Store) in(j *jData) {
+	s.uncache(j.id)
 	e := s.access.PushFront(j)
 	s.cache[j.id] = e
 	s.totalSize += j.size
@@ -103,52 +216,52 @@ func (s *Store) out(e *list.Element) {
 }
 
 func (s *Store) load(id string) (*jData, error) {
-	f, err := os.OpenFile(s.fname(id), os.O_RDONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, err
+	b, modTime, err := s.backend.Load(dataKey(id))
+	if err == backend.ErrNotFound {
+		return s.empty(id), nil
 	}
-	b, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, err
 	}
 	var v interface{}
-	if err = json.Unmarshal(b, &v); err != nil {
-		return nil, err
+	if err = jsonp.Unmarshal(b, &v); err != nil {
+		// The file was torn by a crash before writes became atomic, or
+		// damaged on disk. Keep it for inspection and start over, rather
+		// than failing every request to the document.
+		to, qerr := backend.Quarantine(s.backend, dataKey(id), b)
+		if qerr != nil {
+			return nil, qerr
+		}
+		s.logger.Errorw("torn json data quarantined", "id", id, "key", to.String(), zap.Error(err))
+		return s.empty(id), nil
 	}
-	return &jData{
+	j := &jData{
 		id:         id,
 		value:      v,
 		hash:       s.sha1(b),
-		lastModify: stat.ModTime(),
+		lastModify: modTime,
 		size:       int64(len(b)),
-	}, nil
-}
-
-func (s *Store) save(id string, v interface{}) (*jData, error) {
-	data, err := json.Marshal(v)
-	if err != nil {
-		return nil, err
 	}
-	err = ioutil.WriteFile(s.fname(id), data, 0644)
-	if err != nil {
-		return nil, err
+	if s.historySize > 0 {
+		if err = s.recover(j); err != nil {
+			return nil, err
+		}
 	}
+	return j, nil
+}
+
+// empty returns the data of a document which has no data file.
+func (s *Store) empty(id string) *jData {
+	b := []byte("null")
 	return &jData{
-		id:         id,
-		value:      v,
-		hash:       s.sha1(data),
-		lastModify: time.Now(),
-		size:       int64(len(data)),
-	}, nil
+		id:   id,
+		hash: s.sha1(b),
+		size: int64(len(b)),
+	}
 }
 
-func (s *Store) fname(id string) string {
-	return filepath.Join(s.dataDir, id, "data.json")
+func dataKey(id string) backend.Key {
+	return backend.Key{Doc: id, Name: dataFname}
 }
 
 func (s *Store) sha1(b []byte) string {
@@ -156,3 +269,5 @@ func (s *Store) sha1(b []byte) string {
 	_, _ = sh.Write(b)
 	return hex.EncodeToString(sh.Sum(nil)[:8])
 }
+
+const dataFname = "data.json"
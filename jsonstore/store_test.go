@@ -0,0 +1,120 @@
+package jsonstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disksing/luson/backend"
+	"github.com/disksing/luson/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTornFileQuarantined(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	s := newTestStore(r, dataDir)
+	r.Nil(s.Put("a", map[string]interface{}{"foo": "bar"}))
+	fname := filepath.Join(dataDir, util.DirName("a"), "data.json")
+	r.Nil(ioutil.WriteFile(fname, []byte(`{"foo":"b`), 0644))
+	tmp := filepath.Join(dataDir, util.DirName("a"), ".data.json.tmp123")
+	r.Nil(ioutil.WriteFile(tmp, []byte(`{"foo":"baz"}`), 0644))
+
+	s = newTestStore(r, dataDir)
+	_, err = os.Stat(tmp)
+	r.True(os.IsNotExist(err))
+
+	v, _, err := s.Get("a")
+	r.Nil(err)
+	r.Nil(v)
+	torn, err := filepath.Glob(fname + ".torn-*")
+	r.Nil(err)
+	r.Len(torn, 1)
+
+	// The document is usable again.
+	r.Nil(s.Put("a", "ok"))
+	r.Equal(`"ok"`, readDoc(r, dataDir, "a"))
+}
+
+// blockingBackend blocks the data writes of document "slow" until released.
+type blockingBackend struct {
+	*backend.Memory
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBackend) Save(k backend.Key, data []byte) error {
+	if k.Doc == "slow" && k.Name == "data.json" {
+		b.started <- struct{}{}
+		<-b.release
+	}
+	return b.Memory.Save(k, data)
+}
+
+func TestSlowWriteNotBlocking(t *testing.T) {
+	r := require.New(t)
+	b := &blockingBackend{Memory: backend.NewMemory(), started: make(chan struct{}), release: make(chan struct{})}
+	s := NewStore(b, testConfig, util.NewLogger())
+	r.Nil(s.Put("fast", 1))
+
+	done := make(chan error)
+	go func() { done <- s.Put("slow", 1) }()
+	<-b.started
+	// Other documents are served while the write is in progress.
+	v, _, err := s.Get("fast")
+	r.Nil(err)
+	r.EqualValues(1, v)
+	r.Nil(s.Put("fast", 2))
+	_, err = s.Stat("other")
+	r.Nil(err)
+	close(b.release)
+	r.Nil(<-done)
+	v, _, err = s.Get("slow")
+	r.Nil(err)
+	r.EqualValues(1, v)
+}
+
+func BenchmarkConcurrentDocs(b *testing.B) {
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	f, err := backend.NewFile(dataDir, util.NewLogger())
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := NewStore(f, testConfig, util.NewLogger())
+	const docs = 1000
+	for i := 0; i < docs; i++ {
+		if err = s.Put("doc"+strconv.Itoa(i), map[string]interface{}{"n": i}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// One in ten requests writes a document, the others read.
+	var seq int64
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&seq, 1)
+			id := "doc" + strconv.Itoa(int(n*7919%docs))
+			var err error
+			if n%10 == 0 {
+				err = s.Put(id, map[string]interface{}{"n": n})
+			} else {
+				_, _, err = s.Get(id)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
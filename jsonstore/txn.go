@@ -1,62 +1,145 @@
 package jsonstore
 
 import (
+	"encoding/json"
+	"sort"
 	"time"
 
+	"github.com/disksing/luson/backend"
 	"github.com/pkg/errors"
 )
 
+// ErrConditionNotMatch is the cause of Commit errors when a condition of the
+// transaction does not hold.
+var ErrConditionNotMatch = errors.New("condition not match")
+
+// ErrConflict is the cause of Commit errors when a document read by the
+// transaction is changed by others in the meantime. The transaction can be
+// built again from fresh reads and retried.
+var ErrConflict = errors.New("conflict")
+
 type Txn struct {
 	s                    *Store
 	writes               map[string]interface{}
-	hashConditions       map[string]string
+	deletes              map[string]struct{}
+	readHashes           map[string]string
+	matchConditions      map[string][]string
+	noneMatchConditions  map[string][]string
 	modifyTimeConditions map[string]time.Time
+	origin               *Origin
+	results              map[string]Info
 }
 
 func (s *Store) NewTxn() *Txn {
 	return &Txn{
 		s:                    s,
 		writes:               make(map[string]interface{}),
-		hashConditions:       make(map[string]string),
+		deletes:              make(map[string]struct{}),
+		readHashes:           make(map[string]string),
+		matchConditions:      make(map[string][]string),
+		noneMatchConditions:  make(map[string][]string),
 		modifyTimeConditions: make(map[string]time.Time),
+		results:              make(map[string]Info),
 	}
 }
 
+// Get reads a document. The transaction fails to commit with ErrConflict if
+// the document is changed by others in the meantime. The value is a shared
+// snapshot which must not be modified, writers Put a modified copy.
 func (t *Txn) Get(id string) (interface{}, error) {
 	if v, ok := t.writes[id]; ok {
 		return v, nil
 	}
+	if _, ok := t.deletes[id]; ok {
+		return nil, nil
+	}
 
-	v, hash, err := t.s.Get(id)
+	v, info, err := t.s.Get(id)
 	if err != nil {
 		return nil, err
 	}
-	t.hashConditions[id] = hash
+	if _, ok := t.readHashes[id]; !ok {
+		t.readHashes[id] = info.Hash
+	}
 	return v, nil
 }
 
+// Put writes a document. The value must not be modified afterwards, since
+// it becomes the snapshot read by others once committed.
 func (t *Txn) Put(id string, v interface{}) {
+	delete(t.deletes, id)
 	t.writes[id] = v
 }
 
-func (t *Txn) IfMatchHash(id, hash string) {
-	t.hashConditions[id] = hash
+// Delete removes the data of a document.
+func (t *Txn) Delete(id string) {
+	delete(t.writes, id)
+	t.deletes[id] = struct{}{}
 }
 
+// Writes returns the documents to be written by the transaction, keyed by
+// id. The returned map must not be modified.
+func (t *Txn) Writes() map[string]interface{} {
+	return t.writes
+}
+
+// SetOrigin sets the request recorded in the revisions written by the
+// transaction.
+func (t *Txn) SetOrigin(origin *Origin) {
+	t.origin = origin
+}
+
+// IfMatchHash adds a condition that the hash of the document is one of
+// hashes.
+func (t *Txn) IfMatchHash(id string, hashes ...string) {
+	t.matchConditions[id] = append(t.matchConditions[id], hashes...)
+}
+
+// IfNoneMatchHash adds a condition that the hash of the document is none of
+// hashes.
+func (t *Txn) IfNoneMatchHash(id string, hashes ...string) {
+	t.noneMatchConditions[id] = append(t.noneMatchConditions[id], hashes...)
+}
+
+// IfUnmodifiedSince adds a condition that the document is not modified after
+// v. Modify times are compared in seconds, the resolution of HTTP dates.
 func (t *Txn) IfUnmodifiedSince(id string, v time.Time) {
 	t.modifyTimeConditions[id] = v
 }
 
-func (t *Txn) Commit() error {
-	t.s.Lock()
-	defer t.s.Unlock()
-	for id, hash := range t.hashConditions {
+// Result returns the stored version of a document written by the committed
+// transaction.
+func (t *Txn) Result(id string) (Info, bool) {
+	info, ok := t.results[id]
+	return info, ok
+}
+
+func (t *Txn) check() error {
+	for id, hash := range t.readHashes {
 		j, err := t.s.get(id)
 		if err != nil {
 			return err
 		}
 		if j.hash != hash {
-			return errors.Errorf("hash condition not match, id=" + id)
+			return errors.Wrap(ErrConflict, "document changed, id="+id)
+		}
+	}
+	for id, hashes := range t.matchConditions {
+		j, err := t.s.get(id)
+		if err != nil {
+			return err
+		}
+		if !containsHash(hashes, j.hash) {
+			return errors.Wrap(ErrConditionNotMatch, "hash condition not match, id="+id)
+		}
+	}
+	for id, hashes := range t.noneMatchConditions {
+		j, err := t.s.get(id)
+		if err != nil {
+			return err
+		}
+		if containsHash(hashes, j.hash) {
+			return errors.Wrap(ErrConditionNotMatch, "hash condition not match, id="+id)
 		}
 	}
 	for id, v := range t.modifyTimeConditions {
@@ -64,16 +147,119 @@ func (t *Txn) Commit() error {
 		if err != nil {
 			return err
 		}
-		if j.lastModify.After(v) {
-			return errors.Errorf("modify time condition not match, id=" + id)
+		if j.lastModify.Truncate(time.Second).After(v) {
+			return errors.Wrap(ErrConditionNotMatch, "modify time condition not match, id="+id)
+		}
+	}
+	return nil
+}
+
+func containsHash(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// locked returns the ids of all documents the transaction reads or writes.
+func (t *Txn) locked() []string {
+	var ids []string
+	for id := range t.readHashes {
+		ids = append(ids, id)
+	}
+	for _, m := range []map[string][]string{t.matchConditions, t.noneMatchConditions} {
+		for id := range m {
+			ids = append(ids, id)
 		}
 	}
-	// FIXME: writes not atomic, need some sort of WAL.
-	for id, v := range t.writes {
-		err := t.s.put(id, v)
+	for id := range t.modifyTimeConditions {
+		ids = append(ids, id)
+	}
+	for id := range t.writes {
+		ids = append(ids, id)
+	}
+	for id := range t.deletes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (t *Txn) Commit() error {
+	unlock := t.s.locks.LockAll(t.locked())
+	defer unlock()
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(t.writes))
+	for id := range t.writes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	deletes := make([]string, 0, len(t.deletes))
+	for id := range t.deletes {
+		deletes = append(deletes, id)
+	}
+	sort.Strings(deletes)
+
+	var ops []backend.Op
+	js := make(map[string]*jData, len(ids))
+	for _, id := range ids {
+		data, err := json.Marshal(t.writes[id])
+		if err != nil {
+			return err
+		}
+		j, w, err := t.s.prepare(id, t.writes[id], data, t.origin)
 		if err != nil {
 			return err
 		}
+		js[id] = j
+		ops = append(ops, w...)
+	}
+	for _, id := range deletes {
+		ops = append(ops, backend.Op{Key: dataKey(id)})
+	}
+
+	// A single document is written in order, data first, and its history
+	// is repaired on load if interrupted. Only multi-document transactions
+	// need the batch to be atomic.
+	var err error
+	if len(ids)+len(deletes) > 1 {
+		err = t.s.backend.Batch(ops)
+	} else {
+		err = t.s.write(ops)
+	}
+
+	t.s.Lock()
+	for _, id := range deletes {
+		t.s.uncache(id)
+	}
+	for _, id := range ids {
+		if err != nil {
+			t.s.uncache(id)
+		} else {
+			t.s.in(js[id])
+		}
+	}
+	t.s.evict()
+	listener := t.s.listener
+	t.s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		t.results[id] = js[id].info()
+		if listener != nil {
+			listener(id, js[id].value, js[id].info(), false)
+		}
+	}
+	for _, id := range deletes {
+		if listener != nil {
+			listener(id, nil, Info{}, true)
+		}
 	}
 	return nil
 }
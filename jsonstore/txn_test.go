@@ -0,0 +1,151 @@
+package jsonstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/disksing/luson/backend"
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = &config.Config{JSONCacheSize: 10, HistorySize: 3}
+
+func newTestStore(r *require.Assertions, dataDir string) *Store {
+	b, err := backend.NewFile(dataDir, util.NewLogger())
+	r.Nil(err)
+	return NewStore(b, testConfig, util.NewLogger())
+}
+
+func readDoc(r *require.Assertions, dataDir, id string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dataDir, util.DirName(id), "data.json"))
+	r.Nil(err)
+	return string(b)
+}
+
+func TestTxnBackends(t *testing.T) {
+	r := require.New(t)
+	dataDir, err := ioutil.TempDir("", "luson_test_****")
+	r.Nil(err)
+	defer os.RemoveAll(dataDir)
+
+	for _, name := range []string{config.FileBackend, config.MemoryBackend, config.BoltBackend} {
+		dir := filepath.Join(dataDir, name)
+		r.Nil(os.Mkdir(dir, 0755))
+		b, err := backend.New(config.DataDir(dir), &config.Config{Backend: name}, util.NewLogger())
+		r.Nil(err)
+		s := NewStore(b, testConfig, util.NewLogger())
+
+		for i := 0; i < 5; i++ {
+			txn := s.NewTxn()
+			txn.Put("a", i)
+			txn.Put("b", i*10)
+			r.Nil(txn.Commit(), name)
+		}
+		v, info, err := s.Get("b")
+		r.Nil(err)
+		r.EqualValues(40, v)
+		r.EqualValues(5, info.Version)
+		stat, err := s.Stat("b")
+		r.Nil(err)
+		r.Equal(info.Hash, stat.Hash)
+
+		// The current revision and HistorySize prior ones are kept.
+		revs, err := s.History("a")
+		r.Nil(err)
+		r.Len(revs, 4)
+		r.EqualValues(5, revs[0].Version)
+		r.EqualValues(2, revs[3].Version)
+
+		txn := s.NewTxn()
+		txn.Delete("a")
+		txn.Put("b", "b")
+		r.Nil(txn.Commit())
+		v, _, err = s.Get("a")
+		r.Nil(err)
+		r.Nil(v)
+		r.Nil(b.Close())
+	}
+}
+
+func TestTxnConcurrent(t *testing.T) {
+	r := require.New(t)
+	s := NewStore(backend.NewMemory(), testConfig, util.NewLogger())
+	ids := []string{"a", "b", "c", "d"}
+	for _, id := range ids {
+		r.Nil(s.Put(id, 0))
+	}
+
+	// Transactions move units between documents in both directions, the
+	// total is kept if none of them interleave.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				from, to := ids[(g+i)%len(ids)], ids[(g+i*3+1)%len(ids)]
+				if from == to {
+					continue
+				}
+				for {
+					txn := s.NewTxn()
+					x, err := txn.Get(from)
+					if err == nil {
+						var y interface{}
+						if y, err = txn.Get(to); err == nil {
+							txn.Put(from, x.(int)-1)
+							txn.Put(to, y.(int)+1)
+							err = txn.Commit()
+						}
+					}
+					if errors.Cause(err) == ErrConflict {
+						continue
+					}
+					if err != nil {
+						errs <- err
+					}
+					break
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		r.Nil(err)
+	}
+	var total int
+	for _, id := range ids {
+		v, _, err := s.Get(id)
+		r.Nil(err)
+		total += v.(int)
+	}
+	r.Equal(0, total)
+}
+
+func TestTxnConflict(t *testing.T) {
+	r := require.New(t)
+	s := NewStore(backend.NewMemory(), testConfig, util.NewLogger())
+	r.Nil(s.Put("a", "a0"))
+
+	txn := s.NewTxn()
+	v, err := txn.Get("a")
+	r.Nil(err)
+	r.Equal("a0", v)
+	r.Nil(s.Put("a", "a1"))
+	txn.Put("a", "a2")
+	r.Equal(ErrConflict, errors.Cause(txn.Commit()))
+
+	// A failed precondition is not a conflict.
+	txn = s.NewTxn()
+	txn.IfMatchHash("a", "nope")
+	txn.Put("a", "a2")
+	r.Equal(ErrConditionNotMatch, errors.Cause(txn.Commit()))
+}
@@ -20,7 +20,7 @@ func NewAPIKey(dataDir config.DataDir, logger *util.Logger) (APIKey, error) {
 	if os.IsNotExist(err) {
 		logger.Infof("%s not exist, creating", f)
 		k := uuid.NewV4().String()
-		err = ioutil.WriteFile(f, []byte(k), 0600)
+		err = util.WriteFile(f, []byte(k), 0600)
 		if err != nil {
 			logger.Errorw("failed to persist api key", zap.Error(err))
 			return "", err
@@ -0,0 +1,252 @@
+package key
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Scopes of keys.
+const (
+	ScopeCreate = "create" // create documents
+	ScopeRead   = "read"   // read private documents, list documents
+	ScopeWrite  = "write"  // modify protected and private documents
+	ScopeAdmin  = "admin"  // all of the above, manage keys, schemas and meta
+)
+
+// RootName is the name of the legacy api key, which has the admin scope.
+const RootName = "root"
+
+var (
+	// ErrInvalidKey is the cause of errors creating keys with invalid
+	// attributes.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrKeyExists is returned when creating a key with a name in use.
+	ErrKeyExists = errors.New("key exists")
+)
+
+// Key is a named api key. The secret is only kept as a hash.
+type Key struct {
+	Name    string     `json:"name"`
+	Hash    string     `json:"hash,omitempty"`
+	Scopes  []string   `json:"scopes"`
+	Docs    []string   `json:"docs,omitempty"` // restrict to these documents if not empty
+	Expires *time.Time `json:"expires,omitempty"`
+	Created time.Time  `json:"created"`
+}
+
+// Allows reports if the key grants scope on a document. id is empty for
+// operations not bound to a document, such as creating one, which keys
+// restricted to some documents are not granted.
+func (k *Key) Allows(scope, id string) bool {
+	if !k.AllowsSome(scope) {
+		return false
+	}
+	if len(k.Docs) == 0 {
+		return true
+	}
+	for _, d := range k.Docs {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSome reports if the key grants scope on some documents, each of which
+// must be checked by Allows.
+func (k *Key) AllowsSome(scope string) bool {
+	return k.hasScope(scope) || k.hasScope(ScopeAdmin)
+}
+
+func (k *Key) hasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return k.Expires != nil && !now.Before(*k.Expires)
+}
+
+// Registry holds the api keys. Keys are saved in the data dir, the legacy
+// api key is always accepted as the root key.
+type Registry struct {
+	fname  string
+	root   *Key
+	secret APIKey
+	logger *util.Logger
+
+	sync.Mutex
+	keys   map[string]*Key // by name
+	hashes map[string]*Key // by hash of secret
+}
+
+// NewRegistry loads the keys.
+func NewRegistry(dataDir config.DataDir, apiKey APIKey, logger *util.Logger) (*Registry, error) {
+	r := &Registry{
+		fname:  path.Join(string(dataDir), registryFname),
+		root:   &Key{Name: RootName, Scopes: []string{ScopeAdmin}},
+		secret: apiKey,
+		logger: logger,
+		keys:   make(map[string]*Key),
+		hashes: make(map[string]*Key),
+	}
+	data, err := ioutil.ReadFile(r.fname)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		logger.Errorw("failed to open key file", zap.Error(err))
+		return nil, err
+	}
+	var keys []*Key
+	if err = json.Unmarshal(data, &keys); err != nil {
+		logger.Errorw("failed to parse key file", zap.Error(err))
+		return nil, err
+	}
+	for _, k := range keys {
+		r.keys[k.Name] = k
+		r.hashes[k.Hash] = k
+	}
+	logger.Infow("api keys loaded", "count", len(keys))
+	return r, nil
+}
+
+// Authenticate returns the key of a secret, or nil if the secret is unknown
+// or the key has expired.
+func (r *Registry) Authenticate(secret string) *Key {
+	if secret == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(r.secret)) == 1 {
+		return r.root
+	}
+	r.Lock()
+	defer r.Unlock()
+	k := r.hashes[hashSecret(secret)]
+	if k == nil || k.expired(time.Now()) {
+		return nil
+	}
+	return k
+}
+
+// Create adds a key and returns its secret. The secret can not be recovered
+// later.
+func (r *Registry) Create(k *Key) (string, error) {
+	if k.Name == "" || k.Name == RootName {
+		return "", errors.Wrapf(ErrInvalidKey, "invalid name '%s'", k.Name)
+	}
+	if len(k.Scopes) == 0 {
+		return "", errors.Wrap(ErrInvalidKey, "expect scopes")
+	}
+	for _, s := range k.Scopes {
+		switch s {
+		case ScopeCreate, ScopeRead, ScopeWrite, ScopeAdmin:
+		default:
+			return "", errors.Wrapf(ErrInvalidKey, "invalid scope '%s'", s)
+		}
+	}
+	for _, id := range k.Docs {
+		if !util.IsID(id) {
+			return "", errors.Wrapf(ErrInvalidKey, "invalid document id '%s'", id)
+		}
+	}
+	if k.expired(time.Now()) {
+		return "", errors.Wrap(ErrInvalidKey, "key expires in the past")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(b)
+
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.keys[k.Name]; ok {
+		return "", ErrKeyExists
+	}
+	k.Hash = hashSecret(secret)
+	k.Created = time.Now()
+	r.keys[k.Name] = k
+	r.hashes[k.Hash] = k
+	if err := r.save(); err != nil {
+		delete(r.keys, k.Name)
+		delete(r.hashes, k.Hash)
+		return "", err
+	}
+	return secret, nil
+}
+
+// List returns all keys sorted by name, without the hashes.
+func (r *Registry) List() []Key {
+	r.Lock()
+	defer r.Unlock()
+	res := make([]Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		c := *k
+		c.Hash = ""
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Revoke removes a key. It returns false if the key does not exist.
+func (r *Registry) Revoke(name string) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	k, ok := r.keys[name]
+	if !ok {
+		return false, nil
+	}
+	delete(r.keys, name)
+	delete(r.hashes, k.Hash)
+	if err := r.save(); err != nil {
+		r.keys[name] = k
+		r.hashes[k.Hash] = k
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Registry) save() error {
+	keys := make([]*Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if err = util.WriteFile(r.fname, data, 0600); err != nil {
+		r.logger.Errorw("failed to persist keys", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+const registryFname = "keys.json"
@@ -0,0 +1,118 @@
+package key
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidToken is returned when a share token is malformed, not signed by
+// the server or expired.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ShareToken grants access to a subtree of a document without an api key.
+type ShareToken struct {
+	ID         string   `json:"id"`
+	Pointer    string   `json:"p,omitempty"`
+	Methods    []string `json:"m"`
+	Expires    int64    `json:"exp"`
+	Generation int64    `json:"g"` // tokens are revoked by bumping the generation of the document
+}
+
+// Allows reports if the token grants the method on the node of a document.
+func (t *ShareToken) Allows(id, pointer, method string) bool {
+	if t.ID != id {
+		return false
+	}
+	if pointer != t.Pointer && !strings.HasPrefix(pointer, t.Pointer+"/") {
+		return false
+	}
+	for _, m := range t.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Signer signs and verifies share tokens with a secret in the data dir.
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner loads the signing secret, or creates it on the first run.
+func NewSigner(dataDir config.DataDir, logger *util.Logger) (*Signer, error) {
+	f := path.Join(string(dataDir), signerFname)
+	secret, err := ioutil.ReadFile(f)
+	if os.IsNotExist(err) {
+		logger.Infof("%s not exist, creating", f)
+		secret = make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+		if err = util.WriteFile(f, secret, 0600); err != nil {
+			logger.Errorw("failed to persist share secret", zap.Error(err))
+			return nil, err
+		}
+		return &Signer{secret: secret}, nil
+	}
+	if err != nil {
+		logger.Errorw("failed to open share secret file", zap.Error(err))
+		return nil, err
+	}
+	return &Signer{secret: secret}, nil
+}
+
+// Sign encodes the token as `payload.signature`, both base64url.
+func (s *Signer) Sign(t *ShareToken) (string, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(s.mac(p)), nil
+}
+
+// Verify decodes a token signed by Sign which has not expired.
+func (s *Signer) Verify(token string) (*ShareToken, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, s.mac(token[:i])) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var t ShareToken
+	if err = json.Unmarshal(payload, &t); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= t.Expires {
+		return nil, errors.Wrap(ErrInvalidToken, "token expired")
+	}
+	return &t, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+const signerFname = "share-key"
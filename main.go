@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/disksing/luson/backend"
 	"github.com/disksing/luson/config"
 	"github.com/disksing/luson/jsonstore"
 	"github.com/disksing/luson/key"
@@ -19,11 +20,17 @@ func main() {
 	_ = c.Provide(util.NewLogger)
 	_ = c.Provide(config.NewDataDir)
 	_ = c.Provide(key.NewAPIKey)
+	_ = c.Provide(key.NewRegistry)
+	_ = c.Provide(key.NewSigner)
+	_ = c.Provide(backend.New)
 	_ = c.Provide(metastore.NewStore)
 	_ = c.Provide(jsonstore.NewStore)
 	_ = c.Provide(service.NewJServer)
 	_ = c.Provide(service.NewRouter)
-	_ = c.Invoke(start)
+	if err := c.Invoke(start); err != nil {
+		// The provided logger may be the one which failed to build.
+		util.NewLogger().Fatalw("failed to start", "error", dig.RootCause(err).Error())
+	}
 }
 
 func start(logger *util.Logger, router *mux.Router) {
@@ -0,0 +1,153 @@
+package metastore
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+
+	"github.com/disksing/luson/backend"
+	"github.com/pkg/errors"
+)
+
+// AliasRegexp matches alias names.
+const AliasRegexp = `[a-z0-9][a-z0-9._-]{0,63}`
+
+var aliasRegexp = regexp.MustCompile("^" + AliasRegexp + "$")
+
+var (
+	// ErrInvalidAlias is the cause of PutAlias errors when the name or the
+	// target is invalid.
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasConflict is returned by PutAlias when the alias does not point
+	// to the expected document.
+	ErrAliasConflict = errors.New("alias conflict")
+)
+
+// Alias is a name of a document.
+type Alias struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// IsAlias reports if the name is a valid alias name.
+func IsAlias(name string) bool {
+	return aliasRegexp.MatchString(name)
+}
+
+func (s *Store) loadAliases() error {
+	b, _, err := s.backend.Load(aliasKey)
+	if err == backend.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &s.aliases)
+}
+
+// saveAliases writes the alias table, with aliasLock held.
+func (s *Store) saveAliases() error {
+	s.Lock()
+	b, err := json.Marshal(s.aliases)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.backend.Save(aliasKey, b)
+}
+
+var aliasKey = backend.Key{Name: "aliases.json"}
+
+// ResolveAlias returns the id of the document an alias points to.
+func (s *Store) ResolveAlias(name string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	id, ok := s.aliases[name]
+	return id, ok
+}
+
+// Aliases returns all aliases sorted by name.
+func (s *Store) Aliases() []Alias {
+	s.Lock()
+	defer s.Unlock()
+	res := make([]Alias, 0, len(s.aliases))
+	for name, id := range s.aliases {
+		res = append(res, Alias{Name: name, ID: id})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// PutAlias points an alias to a document. If expect is not nil, the alias
+// must currently point to *expect, or not exist if *expect is empty.
+func (s *Store) PutAlias(name, id string, expect *string) error {
+	if !IsAlias(name) {
+		return errors.Wrapf(ErrInvalidAlias, "name '%s' is invalid", name)
+	}
+	s.aliasLock.Lock()
+	defer s.aliasLock.Unlock()
+	s.Lock()
+	_, exists := s.index[id]
+	old, ok := s.aliases[name]
+	if exists && (expect == nil || old == *expect) {
+		s.aliases[name] = id
+	}
+	s.Unlock()
+	if !exists {
+		return errors.Wrapf(ErrInvalidAlias, "document '%s' not found", id)
+	}
+	if expect != nil && old != *expect {
+		return ErrAliasConflict
+	}
+	if err := s.saveAliases(); err != nil {
+		s.Lock()
+		if ok {
+			s.aliases[name] = old
+		} else {
+			delete(s.aliases, name)
+		}
+		s.Unlock()
+		return err
+	}
+	return nil
+}
+
+// DeleteAlias removes an alias. It returns false if the alias does not
+// exist.
+func (s *Store) DeleteAlias(name string) (bool, error) {
+	s.aliasLock.Lock()
+	defer s.aliasLock.Unlock()
+	s.Lock()
+	id, ok := s.aliases[name]
+	delete(s.aliases, name)
+	s.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := s.saveAliases(); err != nil {
+		s.Lock()
+		s.aliases[name] = id
+		s.Unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// removeAliasesOf removes the aliases of a deleted document.
+func (s *Store) removeAliasesOf(id string) error {
+	s.aliasLock.Lock()
+	defer s.aliasLock.Unlock()
+	var removed bool
+	s.Lock()
+	for name, to := range s.aliases {
+		if to == id {
+			delete(s.aliases, name)
+			removed = true
+		}
+	}
+	s.Unlock()
+	if !removed {
+		return nil
+	}
+	return s.saveAliases()
+}
@@ -0,0 +1,62 @@
+package metastore
+
+import "time"
+
+// Expired reports if the document is expired at the time.
+func (m *MetaData) Expired(now time.Time) bool {
+	return m.Expires != nil && !now.Before(*m.Expires)
+}
+
+// Expired returns the ids of documents expired at the time. They are not
+// visible any more, and wait to be deleted by DeleteExpired.
+func (s *Store) Expired(now time.Time) []string {
+	s.Lock()
+	defer s.Unlock()
+	var ids []string
+	for id, e := range s.index {
+		if e.expired(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// DeleteExpired removes a document with all its values if it is expired at
+// the time. It returns false if the document does not exist or is not
+// expired, for example created again with the same id. deleteData removes
+// the data kept elsewhere first, with the document locked, so that the
+// document cannot be created again in between.
+func (s *Store) DeleteExpired(id string, now time.Time, deleteData func() error) (bool, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	s.Lock()
+	e, ok := s.index[id]
+	expired := ok && e.expired(now)
+	s.Unlock()
+	if !expired {
+		return false, nil
+	}
+	if err := deleteData(); err != nil {
+		return false, err
+	}
+	return true, s.delete(id)
+}
+
+// Slide pushes the expiry of a document with a sliding TTL to the TTL after
+// now. To save a write of the meta data on every access, it is only pushed
+// after a tenth of the TTL has passed.
+func (s *Store) Slide(id string, now time.Time) error {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	m, err := s.get(id)
+	if err != nil || m == nil || m.SlidingTTL == 0 || m.Expired(now) {
+		return err
+	}
+	if m.Expires.Sub(now) > m.SlidingTTL-m.SlidingTTL/10 {
+		return nil
+	}
+	m2 := m.Clone()
+	expires := now.Add(m.SlidingTTL)
+	m2.Expires = &expires
+	return s.put(m2)
+}
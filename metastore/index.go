@@ -0,0 +1,195 @@
+package metastore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Entry is an item of the document index. The stats of the data are filled
+// by the json store through Touch, and are zero until then.
+type Entry struct {
+	ID       string     `json:"id"`
+	Access   string     `json:"access"`
+	Created  time.Time  `json:"created"`
+	Modified time.Time  `json:"modified"`
+	Size     int64      `json:"size"`
+	Hash     string     `json:"hash"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func (e *Entry) hasStat() bool {
+	return e.Hash != ""
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return e.Expires != nil && !now.Before(*e.Expires)
+}
+
+// ErrInvalidCursor is returned by List if the cursor is malformed.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders of List.
+const (
+	SortByCreated  = "created"
+	SortByModified = "modified"
+)
+
+// ListOptions controls the result of List.
+type ListOptions struct {
+	SortBy string // SortByCreated or SortByModified
+	Desc   bool
+	Access string // only list documents with the access level if not empty
+	Cursor string // continue after the cursor returned by the last call
+	Limit  int
+	Filter func(id string) bool // only list documents accepted by the filter if not nil
+}
+
+type cursor struct {
+	T  int64  `json:"t"`
+	ID string `json:"id"`
+}
+
+// buildIndex loads meta data of all documents. It is the only time the
+// documents are scanned.
+func (s *Store) buildIndex() error {
+	ids, err := s.backend.Docs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		m, err := s.load(id)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			// Create was interrupted before meta data is written.
+			continue
+		}
+		s.index[m.ID] = &Entry{ID: m.ID, Access: m.Access, Created: m.Created, Expires: m.Expires}
+	}
+	return nil
+}
+
+func (s *Store) indexPut(m *MetaData) {
+	e, ok := s.index[m.ID]
+	if !ok {
+		e = &Entry{ID: m.ID}
+		s.index[m.ID] = e
+	}
+	e.Access, e.Created, e.Expires = m.Access, m.Created, m.Expires
+}
+
+// Touch updates the data stats of a document in the index.
+func (s *Store) Touch(id string, modified time.Time, size int64, hash string) {
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.index[id]; ok {
+		e.Modified, e.Size, e.Hash = modified, size, hash
+	}
+}
+
+// List returns a page of the document index, and the cursor of the next page
+// which is empty at the end. stat is called for documents whose data stats
+// are not known yet.
+func (s *Store) List(opt ListOptions, stat func(id string) (time.Time, int64, string, error)) ([]Entry, string, error) {
+	var after *cursor
+	if opt.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(opt.Cursor)
+		if err == nil {
+			err = json.Unmarshal(b, &after)
+		}
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	byModified := opt.SortBy == SortByModified
+
+	// stat is slow, call it without holding the lock.
+	if err := s.fillStats(byModified, stat); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	s.Lock()
+	entries := make([]Entry, 0, len(s.index))
+	for _, e := range s.index {
+		if e.expired(now) {
+			continue
+		}
+		if (opt.Access == "" || e.Access == opt.Access) && (opt.Filter == nil || opt.Filter(e.ID)) {
+			entries = append(entries, *e)
+		}
+	}
+	s.Unlock()
+
+	key := func(e *Entry) int64 {
+		if byModified {
+			return e.Modified.UnixNano()
+		}
+		return e.Created.UnixNano()
+	}
+	less := func(t1 int64, id1 string, t2 int64, id2 string) bool {
+		if t1 != t2 {
+			return (t1 < t2) != opt.Desc
+		}
+		if id1 != id2 {
+			return (id1 < id2) != opt.Desc
+		}
+		return false
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return less(key(&entries[i]), entries[i].ID, key(&entries[j]), entries[j].ID)
+	})
+	if after != nil {
+		i := sort.Search(len(entries), func(i int) bool {
+			return less(after.T, after.ID, key(&entries[i]), entries[i].ID)
+		})
+		entries = entries[i:]
+	}
+	var next string
+	if opt.Limit > 0 && len(entries) > opt.Limit {
+		entries = entries[:opt.Limit]
+		last := &entries[len(entries)-1]
+		b, _ := json.Marshal(cursor{T: key(last), ID: last.ID})
+		next = base64.RawURLEncoding.EncodeToString(b)
+	}
+	for i := range entries {
+		if !entries[i].hasStat() {
+			modified, size, hash, err := stat(entries[i].ID)
+			if err != nil {
+				return nil, "", err
+			}
+			entries[i].Modified, entries[i].Size, entries[i].Hash = modified, size, hash
+			s.Touch(entries[i].ID, modified, size, hash)
+		}
+	}
+	return entries, next, nil
+}
+
+// fillStats makes sure the stats of all documents are known when they are
+// needed for sorting.
+func (s *Store) fillStats(all bool, stat func(id string) (time.Time, int64, string, error)) error {
+	if !all {
+		return nil
+	}
+	var ids []string
+	s.Lock()
+	for id, e := range s.index {
+		if !e.hasStat() {
+			ids = append(ids, id)
+		}
+	}
+	s.Unlock()
+	for _, id := range ids {
+		modified, size, hash, err := stat(id)
+		if err != nil {
+			return err
+		}
+		s.Touch(id, modified, size, hash)
+	}
+	return nil
+}
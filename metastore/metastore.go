@@ -3,88 +3,290 @@ package metastore
 import (
 	"container/list"
 	"encoding/json"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"regexp"
 	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/disksing/luson/backend"
 	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/schema"
 	"github.com/disksing/luson/util"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
 )
 
 type Store struct {
-	dataDir       string
+	backend       backend.Backend
 	cacheCapacity int
+	logger        *util.Logger
+	// locks are held across the I/O of documents, and aliasLock across
+	// writes of the alias table.
+	locks     util.Stripes
+	aliasLock sync.Mutex
 
+	// The mutex guards the fields below, it is never held across I/O.
 	sync.Mutex
-	access *list.List
-	cache  map[string]*list.Element
+	access  *list.List
+	cache   map[string]*list.Element
+	index   map[string]*Entry
+	aliases map[string]string // name => id
 }
 
-func NewStore(dataDir config.DataDir, conf *config.Config) *Store {
-	return &Store{
-		dataDir:       string(dataDir),
+func NewStore(b backend.Backend, conf *config.Config, logger *util.Logger) (*Store, error) {
+	s := &Store{
+		backend:       b,
 		cacheCapacity: conf.MetaCacheSize,
+		logger:        logger,
 		access:        list.New(),
 		cache:         make(map[string]*list.Element),
+		index:         make(map[string]*Entry),
+		aliases:       make(map[string]string),
 	}
+	if err := s.buildIndex(); err != nil {
+		logger.Errorw("failed to build index", zap.Error(err))
+		return nil, err
+	}
+	if err := s.loadAliases(); err != nil {
+		logger.Errorw("failed to load aliases", zap.Error(err))
+		return nil, err
+	}
+	return s, nil
 }
 
 func (s *Store) Create() (string, error) {
-	s.Lock()
-	defer s.Unlock()
 	for i := 0; i < 10; i++ {
 		id := uuid.NewV4().String()
-		err := os.Mkdir(filepath.Join(s.dataDir, id), 0755)
-		if os.IsExist(err) {
+		s.Lock()
+		_, ok := s.index[id]
+		s.Unlock()
+		if ok {
 			continue
 		}
+		// Values may be left by an interrupted create.
+		names, err := s.backend.List(id, "")
 		if err != nil {
 			return "", err
 		}
+		if len(names) > 0 {
+			continue
+		}
 		return id, nil
 	}
 	return "", errors.Errorf("failed to allocate valid uuid")
 }
 
-func (s *Store) Get(id string) (*MetaData, error) {
+// ErrExists is returned by Insert when the document exists.
+var ErrExists = errors.New("document exists")
+
+// Insert creates a document with a chosen id and its meta data.
+func (s *Store) Insert(m *MetaData) error {
+	if err := validate(m); err != nil {
+		return err
+	}
+	s.locks.Lock(m.ID)
+	defer s.locks.Unlock(m.ID)
+	s.Lock()
+	_, ok := s.index[m.ID]
+	s.Unlock()
+	if ok {
+		return ErrExists
+	}
+	if err := s.save(m); err != nil {
+		return err
+	}
 	s.Lock()
 	defer s.Unlock()
-	if e, ok := s.cache[id]; ok {
+	s.in(m)
+	s.evict()
+	s.indexPut(m)
+	return nil
+}
+
+// Get returns the meta data of a document, or nil if the document does not
+// exist or is expired. The meta data is shared, see Clone.
+func (s *Store) Get(id string) (*MetaData, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	m, err := s.get(id)
+	if err != nil || m == nil || m.Expired(time.Now()) {
+		return nil, err
+	}
+	return m, nil
+}
+
+// get returns the meta data of a document, the document must be locked.
+func (s *Store) get(id string) (*MetaData, error) {
+	s.Lock()
+	e, ok := s.cache[id]
+	if ok {
 		s.access.MoveToFront(e)
+	}
+	s.Unlock()
+	if ok {
 		return e.Value.(*MetaData), nil
 	}
 	m, err := s.load(id)
 	if err != nil || m == nil {
 		return nil, err
 	}
+	s.Lock()
+	defer s.Unlock()
 	s.in(m)
 	s.evict()
 	return m, nil
 }
 
-func (s *Store) Put(m *MetaData) error {
-	s.Lock()
-	defer s.Unlock()
-	if !util.IsUUID(m.ID) {
-		return errors.Errorf("id is invalid")
+// ErrInvalidMeta is the cause of Put errors when the meta data is invalid.
+var ErrInvalidMeta = errors.New("invalid meta")
+
+// Limits of user-defined meta data.
+const (
+	MaxNameLen        = 128
+	MaxDescriptionLen = 1024
+	MaxLabels         = 64
+	MaxLabelValueLen  = 256
+)
+
+var labelKeyRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]{0,61}[a-z0-9])?$`)
+
+func validate(m *MetaData) error {
+	if !util.IsID(m.ID) {
+		return errors.Wrap(ErrInvalidMeta, "id is invalid")
 	}
 	if !config.ValidateAccess(m.Access) {
-		return errors.Errorf("access is invalid")
+		return errors.Wrap(ErrInvalidMeta, "access is invalid")
 	}
-	if e, ok := s.cache[m.ID]; ok {
-		s.out(e)
+	if m.SlidingTTL < 0 {
+		return errors.Wrap(ErrInvalidMeta, "sliding ttl is negative")
+	}
+	if m.SlidingTTL > 0 && m.Expires == nil {
+		return errors.Wrap(ErrInvalidMeta, "sliding ttl without expiry")
+	}
+	if utf8.RuneCountInString(m.Name) > MaxNameLen {
+		return errors.Wrapf(ErrInvalidMeta, "name is longer than %d", MaxNameLen)
+	}
+	if utf8.RuneCountInString(m.Description) > MaxDescriptionLen {
+		return errors.Wrapf(ErrInvalidMeta, "description is longer than %d", MaxDescriptionLen)
+	}
+	if len(m.Labels) > MaxLabels {
+		return errors.Wrapf(ErrInvalidMeta, "more than %d labels", MaxLabels)
+	}
+	for k, v := range m.Labels {
+		if !labelKeyRegexp.MatchString(k) {
+			return errors.Wrapf(ErrInvalidMeta, "label '%s' is invalid", k)
+		}
+		if utf8.RuneCountInString(v) > MaxLabelValueLen {
+			return errors.Wrapf(ErrInvalidMeta, "value of label '%s' is longer than %d", k, MaxLabelValueLen)
+		}
+	}
+	if m.Schema != nil {
+		if _, err := schema.Compile(m.Schema); err != nil {
+			return errors.Wrap(ErrInvalidMeta, "schema is invalid: "+err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *Store) Put(m *MetaData) error {
+	if err := validate(m); err != nil {
+		return err
+	}
+	s.locks.Lock(m.ID)
+	defer s.locks.Unlock(m.ID)
+	return s.put(m)
+}
+
+// ErrNotFound is the cause of Update errors when the document does not exist
+// or is expired.
+var ErrNotFound = errors.New("document not found")
+
+// Update reads, changes and writes the meta data of a document while it is
+// locked, so concurrent updates are never lost. fn changes a copy of the meta
+// data, which is put if fn succeeds, and returned.
+func (s *Store) Update(id string, fn func(m *MetaData) error) (*MetaData, error) {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	m, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.Expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	m = m.Clone()
+	if err = fn(m); err != nil {
+		return nil, err
 	}
+	if err = validate(m); err != nil {
+		return nil, err
+	}
+	if err = s.put(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// put writes the meta data, the document must be locked.
+func (s *Store) put(m *MetaData) error {
+	s.Lock()
+	s.uncache(m.ID)
+	s.Unlock()
 	err := s.save(m)
 	if err != nil {
 		return err
 	}
+	s.Lock()
+	defer s.Unlock()
 	s.in(m)
+	s.evict()
+	s.indexPut(m)
 	return nil
 }
 
+// Delete removes a document with all its values.
+func (s *Store) Delete(id string) error {
+	if !util.IsID(id) {
+		return errors.Errorf("id is invalid")
+	}
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	return s.delete(id)
+}
+
+// DeleteWith removes a document with all its values. deleteData removes the
+// data kept elsewhere first, with the document locked, so that readers of the
+// meta data never see it without the data. Nothing is deleted if it fails.
+func (s *Store) DeleteWith(id string, deleteData func() error) error {
+	s.locks.Lock(id)
+	defer s.locks.Unlock(id)
+	m, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if m == nil || m.Expired(time.Now()) {
+		return ErrNotFound
+	}
+	if err = deleteData(); err != nil {
+		return err
+	}
+	return s.delete(id)
+}
+
+// delete removes a document, the document must be locked.
+func (s *Store) delete(id string) error {
+	s.Lock()
+	s.uncache(id)
+	delete(s.index, id)
+	s.Unlock()
+	if err := s.removeAliasesOf(id); err != nil {
+		return err
+	}
+	return s.backend.Delete(backend.Key{Doc: id})
+}
+
 func (s *Store) evict() {
 	for len(s.cache) > s.cacheCapacity {
 		s.out(s.access.Back())
@@ -96,32 +298,49 @@ func (s *Store) in(m *MetaData) {
 	s.cache[m.ID] = e
 }
 
+func (s *Store) uncache(id string) {
+	if e, ok := s.cache[id]; ok {
+		s.out(e)
+	}
+}
+
 func (s *Store) out(e *list.Element) {
-	m := e.Value.(MetaData)
+	m := e.Value.(*MetaData)
 	s.access.Remove(e)
 	delete(s.cache, m.ID)
 }
 
 func (s *Store) load(id string) (*MetaData, error) {
-	f, err := os.OpenFile(s.fname(id), os.O_RDONLY, 0644)
-	if os.IsNotExist(err) {
+	b, modTime, err := s.backend.Load(metaKey(id))
+	if err == backend.ErrNotFound {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
-	}
 	var v MetaData
-	if err = json.Unmarshal(b, &v); err != nil {
-		return nil, err
+	if err = jsonp.Unmarshal(b, &v); err != nil {
+		// Keep the torn file for inspection and fall back to the most
+		// restrictive access, so the document is still reachable with the
+		// api key.
+		to, qerr := backend.Quarantine(s.backend, metaKey(id), b)
+		if qerr != nil {
+			return nil, qerr
+		}
+		s.logger.Errorw("torn meta data quarantined", "id", id, "key", to.String(), zap.Error(err))
+		v = MetaData{ID: id, Access: config.Private}
+		if err = s.save(&v); err != nil {
+			return nil, err
+		}
+		return &v, nil
 	}
 	if !config.ValidateAccess(v.Access) {
 		v.Access = config.Private
 	}
+	if v.Created.IsZero() {
+		// Created before the field is introduced.
+		v.Created = modTime
+	}
 	return &v, nil
 }
 
@@ -130,14 +349,36 @@ func (s *Store) save(m *MetaData) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(s.fname(m.ID), b, 0644)
+	return s.backend.Save(metaKey(m.ID), b)
 }
 
-func (s *Store) fname(id string) string {
-	return filepath.Join(s.dataDir, id, "meta.json")
+func metaKey(id string) backend.Key {
+	return backend.Key{Doc: id, Name: metaFname}
 }
 
 type MetaData struct {
-	ID     string `json:"id"`
-	Access string `json:"access"`
+	ID      string      `json:"id"`
+	Access  string      `json:"access"`
+	Created time.Time   `json:"created"`
+	Schema  interface{} `json:"schema,omitempty"`
+	// User-defined meta data.
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// ShareGeneration is bumped to revoke all share tokens of the document.
+	ShareGeneration int64 `json:"shareGeneration,omitempty"`
+	// Expires is when the document expires, nil if it never does. If
+	// SlidingTTL is not zero, reads and writes push it to SlidingTTL later.
+	Expires    *time.Time    `json:"expires,omitempty"`
+	SlidingTTL time.Duration `json:"slidingTTL,omitempty"`
 }
+
+// Clone returns a copy of the meta data to update. Meta data returned by the
+// store is cached and shared by all readers, so it must never be modified in
+// place. The copy is shallow: fields are replaced, not changed, on the copy.
+func (m *MetaData) Clone() *MetaData {
+	m2 := *m
+	return &m2
+}
+
+const metaFname = "meta.json"
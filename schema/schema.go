@@ -0,0 +1,547 @@
+// Package schema validates JSON documents against JSON Schema.
+//
+// A subset of draft 2020-12 is supported: the applicator keywords (allOf,
+// anyOf, oneOf, not, if/then/else, properties, patternProperties,
+// additionalProperties, propertyNames, prefixItems, items, contains), the
+// validation keywords, and `$ref` to local `$defs`. Other keywords such as
+// `format` are annotations and ignored.
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/pkg/errors"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+	refs     map[string]bool // compiled $ref targets
+}
+
+// Error is a validation failure of the node at Pointer.
+type Error struct {
+	Pointer string `json:"pointer"`
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// Compile checks a schema and prepares it for validation.
+func Compile(v interface{}) (*Schema, error) {
+	s := &Schema{root: v, patterns: make(map[string]*regexp.Regexp), refs: make(map[string]bool)}
+	if err := s.compile(v, ""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var schemaKeywords = []string{"not", "if", "then", "else", "items", "contains", "additionalProperties", "propertyNames"}
+var schemaListKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems"}
+var schemaMapKeywords = []string{"properties", "patternProperties", "$defs"}
+
+func (s *Schema) compile(v interface{}, at string) error {
+	if _, ok := v.(bool); ok {
+		return nil
+	}
+	obj, ok := v.(jsonp.Object)
+	if !ok {
+		return errors.Errorf("schema at '%s' is not an object or boolean", at)
+	}
+	for _, k := range schemaKeywords {
+		if sub, ok := obj[k]; ok {
+			if err := s.compile(sub, at+"/"+k); err != nil {
+				return err
+			}
+		}
+	}
+	for _, k := range schemaListKeywords {
+		if sub, ok := obj[k]; ok {
+			arr, ok := sub.(jsonp.Array)
+			if !ok || (len(arr) == 0 && k != "prefixItems") {
+				return errors.Errorf("'%s' at '%s' is not a non-empty array", k, at)
+			}
+			for i, x := range arr {
+				if err := s.compile(x, at+"/"+k+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, k := range schemaMapKeywords {
+		if sub, ok := obj[k]; ok {
+			m, ok := sub.(jsonp.Object)
+			if !ok {
+				return errors.Errorf("'%s' at '%s' is not an object", k, at)
+			}
+			for name, x := range m {
+				if k == "patternProperties" {
+					if err := s.compilePattern(name, at); err != nil {
+						return err
+					}
+				}
+				if err := s.compile(x, at+"/"+k+"/"+jsonp.PointerEscaper.Replace(name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if p, ok := obj["pattern"]; ok {
+		str, ok := p.(string)
+		if !ok {
+			return errors.Errorf("'pattern' at '%s' is not a string", at)
+		}
+		if err := s.compilePattern(str, at); err != nil {
+			return err
+		}
+	}
+	if t, ok := obj["type"]; ok {
+		types, ok := t.(jsonp.Array)
+		if !ok {
+			types = jsonp.Array{t}
+		}
+		for _, t := range types {
+			if str, ok := t.(string); !ok || !validType(str) {
+				return errors.Errorf("invalid type %v at '%s'", t, at)
+			}
+		}
+	}
+	if ref, ok := obj["$ref"]; ok {
+		str, ok := ref.(string)
+		if !ok {
+			return errors.Errorf("'$ref' at '%s' is not a string", at)
+		}
+		if err := s.compileRef(str); err != nil {
+			return err
+		}
+	}
+	if req, ok := obj["required"]; ok {
+		if !isStringArray(req) {
+			return errors.Errorf("'required' at '%s' is not an array of strings", at)
+		}
+	}
+	for _, k := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf"} {
+		if n, ok := obj[k]; ok {
+			if _, ok := jsonp.Number(n); !ok {
+				return errors.Errorf("'%s' at '%s' is not a number", k, at)
+			}
+		}
+	}
+	for _, k := range []string{"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties", "minContains", "maxContains"} {
+		if n, ok := obj[k]; ok {
+			if r, ok := jsonp.Number(n); !ok || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+				return errors.Errorf("'%s' at '%s' is not a non-negative integer", k, at)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compilePattern(p, at string) error {
+	if _, ok := s.patterns[p]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return errors.Wrapf(err, "invalid pattern at '%s'", at)
+	}
+	s.patterns[p] = re
+	return nil
+}
+
+// compileRef checks that a $ref points to a schema. Each target is compiled
+// once, which also ends recursive references.
+func (s *Schema) compileRef(ref string) error {
+	if s.refs[ref] {
+		return nil
+	}
+	s.refs[ref] = true
+	target, err := s.resolve(ref)
+	if err != nil {
+		return err
+	}
+	return s.compile(target, ref)
+}
+
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errors.Errorf("unsupported $ref '%s', only local references are supported", ref)
+	}
+	v, err := jsonp.Get(s.root, ref[1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve $ref '%s'", ref)
+	}
+	return v, nil
+}
+
+func validType(t string) bool {
+	switch t {
+	case "null", "boolean", "object", "array", "number", "string", "integer":
+		return true
+	}
+	return false
+}
+
+func isStringArray(v interface{}) bool {
+	arr, ok := v.(jsonp.Array)
+	if !ok {
+		return false
+	}
+	for _, x := range arr {
+		if _, ok := x.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns the failures of a document, or nil if it is valid.
+func (s *Schema) Validate(v interface{}) []Error {
+	var errs []Error
+	vd := &validator{Schema: s, work: baseWork + workPerNode*countNodes(v)}
+	vd.validate(s.root, v, "", &errs, 0)
+	if vd.aborted {
+		return []Error{{Keyword: "$ref", Message: "schema is too deep or too expensive to apply"}}
+	}
+	return errs
+}
+
+// Limits of $ref, which lets a schema apply itself without consuming the
+// document. maxDepth bounds recursion such as `{"$ref": "#"}`, and the work,
+// the number of schemas applied, bounds fan out such as
+// `{"anyOf": [{"$ref": "#"}, {"$ref": "#"}]}` which takes exponential time.
+// The work grows with the document so that large documents can be validated.
+const (
+	maxDepth    = 64
+	baseWork    = 1 << 16
+	workPerNode = 64
+)
+
+// validator is a schema being applied to a document.
+type validator struct {
+	*Schema
+	work    int  // the number of schemas which may still be applied
+	aborted bool // a limit is hit, the document is invalid
+}
+
+func countNodes(v interface{}) int {
+	n := 1
+	switch x := v.(type) {
+	case jsonp.Object:
+		for _, e := range x {
+			n += countNodes(e)
+		}
+	case jsonp.Array:
+		for _, e := range x {
+			n += countNodes(e)
+		}
+	}
+	return n
+}
+
+func (s *validator) valid(schema, v interface{}, pointer string, depth int) bool {
+	var errs []Error
+	s.validate(schema, v, pointer, &errs, depth)
+	return len(errs) == 0
+}
+
+func (s *validator) validate(schema, v interface{}, pointer string, errs *[]Error, depth int) {
+	// The results of aborted validations are not used, so skip the rest.
+	if s.aborted {
+		return
+	}
+	if s.work--; s.work < 0 || depth > maxDepth {
+		s.aborted = true
+		return
+	}
+	fail := func(keyword, format string, args ...interface{}) {
+		*errs = append(*errs, Error{Pointer: pointer, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	if b, ok := schema.(bool); ok {
+		if !b {
+			fail("false", "no value is allowed")
+		}
+		return
+	}
+	obj, ok := schema.(jsonp.Object)
+	if !ok {
+		fail("$ref", "schema is not an object or boolean")
+		return
+	}
+	if ref, ok := obj["$ref"]; ok {
+		sub, _ := s.resolve(ref.(string))
+		s.validate(sub, v, pointer, errs, depth+1)
+	}
+	if t, ok := obj["type"]; ok {
+		types, ok := t.(jsonp.Array)
+		if !ok {
+			types = jsonp.Array{t}
+		}
+		matched := false
+		for _, t := range types {
+			if hasType(v, t.(string)) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("type", "expected %s, got %s", joinTypes(types), typeOf(v))
+		}
+	}
+	if e, ok := obj["enum"]; ok {
+		if arr, ok := e.(jsonp.Array); ok {
+			found := false
+			for _, x := range arr {
+				if jsonp.Equal(x, v) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("enum", "value is not one of the enumerated values")
+			}
+		}
+	}
+	if c, ok := obj["const"]; ok && !jsonp.Equal(c, v) {
+		fail("const", "value does not equal the constant")
+	}
+
+	// Combinators.
+	if all, ok := obj["allOf"].(jsonp.Array); ok {
+		for _, sub := range all {
+			s.validate(sub, v, pointer, errs, depth+1)
+		}
+	}
+	if any, ok := obj["anyOf"].(jsonp.Array); ok {
+		matched := false
+		for _, sub := range any {
+			if s.valid(sub, v, pointer, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("anyOf", "value does not match any schema")
+		}
+	}
+	if one, ok := obj["oneOf"].(jsonp.Array); ok {
+		n := 0
+		for _, sub := range one {
+			if s.valid(sub, v, pointer, depth+1) {
+				n++
+			}
+		}
+		if n != 1 {
+			fail("oneOf", "value matches %d schemas, expected exactly one", n)
+		}
+	}
+	if not, ok := obj["not"]; ok && s.valid(not, v, pointer, depth+1) {
+		fail("not", "value must not match the schema")
+	}
+	if cond, ok := obj["if"]; ok {
+		if s.valid(cond, v, pointer, depth+1) {
+			if then, ok := obj["then"]; ok {
+				s.validate(then, v, pointer, errs, depth+1)
+			}
+		} else if els, ok := obj["else"]; ok {
+			s.validate(els, v, pointer, errs, depth+1)
+		}
+	}
+
+	switch x := v.(type) {
+	case jsonp.Object:
+		s.validateObject(obj, x, pointer, errs, depth, fail)
+	case jsonp.Array:
+		s.validateArray(obj, x, pointer, errs, depth, fail)
+	case string:
+		n := utf8.RuneCountInString(x)
+		if min, ok := getInt(obj, "minLength"); ok && n < min {
+			fail("minLength", "string is shorter than %d", min)
+		}
+		if max, ok := getInt(obj, "maxLength"); ok && n > max {
+			fail("maxLength", "string is longer than %d", max)
+		}
+		if p, ok := obj["pattern"].(string); ok && !s.patterns[p].MatchString(x) {
+			fail("pattern", "string does not match pattern %s", p)
+		}
+	default:
+		if n, ok := jsonp.Number(v); ok {
+			validateNumber(obj, n, fail)
+		}
+	}
+}
+
+func (s *validator) validateObject(schema, obj jsonp.Object, pointer string, errs *[]Error, depth int, fail func(string, string, ...interface{})) {
+	if min, ok := getInt(schema, "minProperties"); ok && len(obj) < min {
+		fail("minProperties", "object has less than %d properties", min)
+	}
+	if max, ok := getInt(schema, "maxProperties"); ok && len(obj) > max {
+		fail("maxProperties", "object has more than %d properties", max)
+	}
+	if req, ok := schema["required"].(jsonp.Array); ok {
+		for _, k := range req {
+			if _, ok := obj[k.(string)]; !ok {
+				fail("required", "missing property %s", k)
+			}
+		}
+	}
+	if deps, ok := schema["dependentRequired"].(jsonp.Object); ok {
+		for k, req := range deps {
+			if _, ok := obj[k]; !ok || !isStringArray(req) {
+				continue
+			}
+			for _, r := range req.(jsonp.Array) {
+				if _, ok := obj[r.(string)]; !ok {
+					fail("dependentRequired", "property %s is required by %s", r, k)
+				}
+			}
+		}
+	}
+	props, _ := schema["properties"].(jsonp.Object)
+	patterns, _ := schema["patternProperties"].(jsonp.Object)
+	additional, hasAdditional := schema["additionalProperties"]
+	names, hasNames := schema["propertyNames"]
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := pointer + "/" + jsonp.PointerEscaper.Replace(k)
+		if hasNames && !s.valid(names, k, p, depth+1) {
+			fail("propertyNames", "invalid property name %s", k)
+		}
+		matched := false
+		if sub, ok := props[k]; ok {
+			matched = true
+			s.validate(sub, obj[k], p, errs, depth+1)
+		}
+		for pattern, sub := range patterns {
+			if s.patterns[pattern].MatchString(k) {
+				matched = true
+				s.validate(sub, obj[k], p, errs, depth+1)
+			}
+		}
+		if !matched && hasAdditional {
+			s.validate(additional, obj[k], p, errs, depth+1)
+		}
+	}
+}
+
+func (s *validator) validateArray(schema jsonp.Object, arr jsonp.Array, pointer string, errs *[]Error, depth int, fail func(string, string, ...interface{})) {
+	if min, ok := getInt(schema, "minItems"); ok && len(arr) < min {
+		fail("minItems", "array has less than %d items", min)
+	}
+	if max, ok := getInt(schema, "maxItems"); ok && len(arr) > max {
+		fail("maxItems", "array has more than %d items", max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	outer:
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if jsonp.Equal(arr[i], arr[j]) {
+					fail("uniqueItems", "items %d and %d are equal", j, i)
+					break outer
+				}
+			}
+		}
+	}
+	prefix, _ := schema["prefixItems"].(jsonp.Array)
+	for i, x := range arr {
+		p := pointer + "/" + strconv.Itoa(i)
+		if i < len(prefix) {
+			s.validate(prefix[i], x, p, errs, depth+1)
+		} else if items, ok := schema["items"]; ok {
+			s.validate(items, x, p, errs, depth+1)
+		}
+	}
+	if contains, ok := schema["contains"]; ok {
+		n := 0
+		for i, x := range arr {
+			if s.valid(contains, x, pointer+"/"+strconv.Itoa(i), depth+1) {
+				n++
+			}
+		}
+		min, ok := getInt(schema, "minContains")
+		if !ok {
+			min = 1
+		}
+		if n < min {
+			fail("contains", "array contains %d matching items, expected at least %d", n, min)
+		}
+		if max, ok := getInt(schema, "maxContains"); ok && n > max {
+			fail("maxContains", "array contains %d matching items, expected at most %d", n, max)
+		}
+	}
+}
+
+func validateNumber(schema jsonp.Object, n *big.Rat, fail func(string, string, ...interface{})) {
+	check := func(keyword string, ok func(c int) bool, desc string) {
+		if limit, has := jsonp.Number(schema[keyword]); has && !ok(n.Cmp(limit)) {
+			fail(keyword, "value must be %s %s", desc, limit.RatString())
+		}
+	}
+	check("minimum", func(c int) bool { return c >= 0 }, ">=")
+	check("maximum", func(c int) bool { return c <= 0 }, "<=")
+	check("exclusiveMinimum", func(c int) bool { return c > 0 }, ">")
+	check("exclusiveMaximum", func(c int) bool { return c < 0 }, "<")
+	if m, ok := jsonp.Number(schema["multipleOf"]); ok && m.Sign() > 0 {
+		if !new(big.Rat).Quo(n, m).IsInt() {
+			fail("multipleOf", "value must be a multiple of %s", m.RatString())
+		}
+	}
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := jsonp.Number(v)
+		return ok && n.IsInt()
+	case "number":
+		_, ok := jsonp.Number(v)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case jsonp.Object:
+		return "object"
+	case jsonp.Array:
+		return "array"
+	}
+	if _, ok := jsonp.Number(v); ok {
+		return "number"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func joinTypes(types jsonp.Array) string {
+	strs := make([]string, 0, len(types))
+	for _, t := range types {
+		strs = append(strs, t.(string))
+	}
+	return strings.Join(strs, " or ")
+}
+
+func getInt(schema jsonp.Object, keyword string) (int, bool) {
+	n, ok := jsonp.Number(schema[keyword])
+	if !ok || !n.IsInt() {
+		return 0, false
+	}
+	return int(n.Num().Int64()), true
+}
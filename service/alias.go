@@ -0,0 +1,137 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/disksing/luson/metastore"
+	"github.com/disksing/luson/util"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// resolveID returns the UUID of a document referred by its UUID or by
+// `@alias`.
+func (js *JServer) resolveID(id string) (string, bool) {
+	if strings.HasPrefix(id, "@") {
+		return js.mstore.ResolveAlias(id[1:])
+	}
+	return id, util.IsID(id)
+}
+
+// aliasHandler serves requests to `/@alias/...` as requests to the document
+// the alias points to.
+func (js *JServer) aliasHandler(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := newCtx(w, r)
+		path := r.URL.EscapedPath()
+		i := strings.IndexByte(path[1:], '/') + 1
+		if i == 0 {
+			i = len(path)
+		}
+		name, err := url.PathUnescape(path[1:i])
+		if err != nil {
+			ctx.text(http.StatusBadRequest, "failed to unescape request URI")
+			return
+		}
+		id, ok := js.resolveID(name)
+		if !ok {
+			ctx.text(http.StatusNotFound, "alias not found")
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.RawPath = "/" + id + path[i:]
+		r2.URL.Path, err = url.PathUnescape(r2.URL.RawPath)
+		if err != nil {
+			ctx.text(http.StatusBadRequest, "failed to unescape request URI")
+			return
+		}
+		next.ServeHTTP(w, r2)
+	}
+}
+
+type aliasRequest struct {
+	ID     string  `json:"id"`
+	Expect *string `json:"expect"` // the current target, or empty if the alias must not exist
+}
+
+// ListAliases handles requests listing aliases.
+func (js *JServer) ListAliases(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	ctx.json(http.StatusOK, js.mstore.Aliases())
+}
+
+// GetAlias handles requests reading an alias.
+func (js *JServer) GetAlias(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	id, ok := js.mstore.ResolveAlias(name)
+	if !ok {
+		ctx.text(http.StatusNotFound, name)
+		return
+	}
+	ctx.json(http.StatusOK, &metastore.Alias{Name: name, ID: id})
+}
+
+// PutAlias handles requests creating or re-pointing an alias. With `expect`,
+// the alias is only changed if it still points to the expected document.
+func (js *JServer) PutAlias(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	var req aliasRequest
+	data, ok := ctx.readBody()
+	if !ok || !ctx.unmarshalJSON(data, &req) {
+		return
+	}
+	err := js.mstore.PutAlias(name, req.ID, req.Expect)
+	if err == metastore.ErrAliasConflict {
+		ctx.text(http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	if errors.Cause(err) == metastore.ErrInvalidAlias {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		js.logger.Error("failed to put alias", zap.String("cmd", "alias"), zap.String("name", name), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write aliases")
+		return
+	}
+	js.logger.Info("alias", zap.String("name", name), zap.String("id", req.ID))
+	ctx.json(http.StatusOK, &metastore.Alias{Name: name, ID: req.ID})
+}
+
+// DeleteAlias handles requests removing an alias.
+func (js *JServer) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	ok, err := js.mstore.DeleteAlias(name)
+	if err != nil {
+		js.logger.Error("failed to delete alias", zap.String("cmd", "alias"), zap.String("name", name), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write aliases")
+		return
+	}
+	if !ok {
+		ctx.text(http.StatusNotFound, name)
+		return
+	}
+	ctx.statusText(http.StatusOK)
+}
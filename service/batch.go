@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/jsonstore"
+)
+
+const maxBatchOps = 1000
+
+type batchRequest struct {
+	Atomic bool       `json:"atomic"`
+	Ops    []*batchOp `json:"ops"`
+}
+
+type batchOp struct {
+	Op          string          `json:"op"` // get, put, merge-patch, json-patch or delete
+	ID          string          `json:"id"`
+	Path        string          `json:"path"`
+	Body        json.RawMessage `json:"body"`
+	IfMatch     string          `json:"ifMatch"`
+	IfNoneMatch string          `json:"ifNoneMatch"`
+}
+
+var batchMethods = map[string]string{
+	"get":         http.MethodGet,
+	"put":         http.MethodPut,
+	"merge-patch": http.MethodPatch,
+	"json-patch":  http.MethodPatch,
+	"delete":      http.MethodDelete,
+}
+
+type batchResult struct {
+	Status int         `json:"status"`
+	ETag   string      `json:"etag,omitempty"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	Results []*batchResult `json:"results"`
+	Error   *batchResult   `json:"error,omitempty"` // commit failure of atomic batches
+}
+
+// Batch handles requests running many operations in one round trip. Each
+// operation is checked as the equivalent HTTP request. Without `atomic`,
+// operations run one by one and fail independently. With `atomic`, all
+// writes are committed in a single transaction, or none if any operation
+// fails.
+func (js *JServer) Batch(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	var req batchRequest
+	data, ok := ctx.readBody()
+	if !ok || !ctx.unmarshalJSON(data, &req) {
+		return
+	}
+	if len(req.Ops) > maxBatchOps {
+		ctx.text(http.StatusBadRequest, "too many operations")
+		return
+	}
+	for _, op := range req.Ops {
+		if _, ok := batchMethods[op.Op]; !ok {
+			ctx.text(http.StatusBadRequest, "invalid op "+op.Op)
+			return
+		}
+		if op.Path != "" && op.Path[0] != '/' {
+			ctx.text(http.StatusBadRequest, "invalid path "+op.Path)
+			return
+		}
+	}
+
+	if req.Atomic {
+		ctx.json(http.StatusOK, js.batchAtomic(ctx, req.Ops))
+		return
+	}
+	res := &batchResponse{Results: make([]*batchResult, 0, len(req.Ops))}
+	for _, op := range req.Ops {
+		res.Results = append(res.Results, js.batchOne(ctx, op))
+	}
+	ctx.json(http.StatusOK, res)
+}
+
+// batchOne runs an operation as a HTTP request.
+func (js *JServer) batchOne(ctx *httpCtx, op *batchOp) *batchResult {
+	octx, rec, id, ok := js.batchCtx(ctx, op)
+	if !ok {
+		return rec.result()
+	}
+	r := octx.r
+	r.URL.RawPath = docURL(id, op.Path)
+	r.URL.Path, _ = url.PathUnescape(r.URL.RawPath)
+	r.Body = ioutil.NopCloser(bytes.NewReader(op.Body))
+	switch op.Op {
+	case "get":
+		js.Get(rec, r)
+	case "put":
+		js.Put(rec, r)
+	case "merge-patch", "json-patch":
+		js.Patch(rec, r)
+	case "delete":
+		js.Delete(rec, r)
+	}
+	return rec.result()
+}
+
+// batchAtomic runs all operations in one transaction.
+func (js *JServer) batchAtomic(ctx *httpCtx, ops []*batchOp) *batchResponse {
+	res := &batchResponse{Results: make([]*batchResult, len(ops))}
+	fail := func(i int, r *batchResult) *batchResponse {
+		for j := range res.Results {
+			res.Results[j] = &batchResult{Status: http.StatusFailedDependency}
+		}
+		if i >= 0 {
+			res.Results[i] = r
+		} else {
+			res.Error = r
+		}
+		return res
+	}
+
+	var failed *batchResponse
+	var ids []string // written documents
+	var deleted []string
+	crec := newRecorder()
+	cctx := newCtx(crec, ctx.r)
+	// Operations run again on fresh snapshots if the transaction conflicts.
+	txn, ok := js.update(cctx, func(txn *jsonstore.Txn) bool {
+		res.Results = make([]*batchResult, len(ops))
+		ids, deleted = make([]string, len(ops)), nil
+		for i, op := range ops {
+			octx, rec, id, ok := js.batchCtx(ctx, op)
+			if ok {
+				var v interface{}
+				switch op.Op {
+				case "get":
+					v, ok = js.txnGetForRead(octx, txn, id, op.Path)
+					if ok {
+						if v, ok = batchGet(octx, v, op.Path); ok {
+							res.Results[i] = &batchResult{Status: http.StatusOK, Body: v}
+						}
+					}
+				case "put":
+					if v, ok = octx.parseJSON(op.Body); ok {
+						ok = js.put(octx, txn, id, op.Path, v)
+					}
+				case "merge-patch":
+					if v, ok = octx.parseJSON(op.Body); ok {
+						ok = js.mergePatchTxn(octx, txn, id, op.Path, v)
+					}
+				case "json-patch":
+					ok = js.jsonPatchTxn(octx, txn, id, op.Path, op.Body)
+				case "delete":
+					ok = js.delete(octx, txn, id, op.Path)
+					if ok && op.Path == "" {
+						deleted = append(deleted, id)
+					}
+				}
+			}
+			if !ok {
+				failed = fail(i, rec.result())
+				return false
+			}
+			if res.Results[i] == nil {
+				res.Results[i] = &batchResult{Status: http.StatusOK}
+			}
+			if op.Op != "get" {
+				ids[i] = id
+			}
+		}
+		return true
+	})
+	if failed != nil {
+		return failed
+	}
+	if !ok {
+		return fail(-1, crec.result())
+	}
+	for _, id := range deleted {
+		if _, ok := txn.Result(id); ok {
+			// Written again by a later operation.
+			continue
+		}
+		if !js.deleteMeta(cctx, id) {
+			return fail(-1, crec.result())
+		}
+	}
+	for i, id := range ids {
+		if info, ok := txn.Result(id); ok && id != "" {
+			res.Results[i].ETag = info.Hash
+		}
+	}
+	return res
+}
+
+// batchCtx makes the context of an operation, with the credentials of the
+// batch request.
+func (js *JServer) batchCtx(ctx *httpCtx, op *batchOp) (*httpCtx, *recorder, string, bool) {
+	rec := newRecorder()
+	r := ctx.r.Clone(ctx.r.Context())
+	r.Method = batchMethods[op.Op]
+	r.Header.Del("If-Match")
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	r.Header.Del("If-Unmodified-Since")
+	r.Header.Del("Accept")
+	if op.IfMatch != "" {
+		r.Header.Set("If-Match", op.IfMatch)
+	}
+	if op.IfNoneMatch != "" {
+		r.Header.Set("If-None-Match", op.IfNoneMatch)
+	}
+	switch op.Op {
+	case "merge-patch":
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+	case "json-patch":
+		r.Header.Set("Content-Type", "application/json-patch+json")
+	default:
+		r.Header.Set("Content-Type", "application/json")
+	}
+	// Keep the share token, if any.
+	q := url.Values{}
+	if t := ctx.r.URL.Query().Get("token"); t != "" {
+		q.Set("token", t)
+	}
+	r.URL.RawQuery = q.Encode()
+	octx := newCtx(rec, r)
+
+	id, ok := js.resolveID(op.ID)
+	if !ok {
+		if strings.HasPrefix(op.ID, "@") {
+			octx.text(http.StatusNotFound, "alias not found")
+		} else {
+			octx.text(http.StatusBadRequest, "expected id")
+		}
+		return octx, rec, "", false
+	}
+	return octx, rec, id, true
+}
+
+func batchGet(ctx *httpCtx, v interface{}, p string) (interface{}, bool) {
+	v, err := jsonp.Get(v, p)
+	if err != nil {
+		ctx.text(http.StatusNotAcceptable, err.Error())
+		return nil, false
+	}
+	return v, true
+}
+
+// result converts the recorded response of an operation.
+func (r *recorder) result() *batchResult {
+	res := &batchResult{Status: r.status, ETag: strings.Trim(r.header.Get("ETag"), `"`)}
+	if r.body.Len() == 0 {
+		return res
+	}
+	if strings.HasPrefix(r.header.Get("Content-Type"), "application/json") {
+		res.Body = json.RawMessage(r.body.Bytes())
+	} else {
+		res.Body = r.body.String()
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disksing/luson/codec"
+)
+
+// jsonTypes are request content types read as JSON, for clients which do not
+// set a JSON type, such as curl.
+var jsonTypes = map[string]bool{
+	"":                                  true,
+	"text/plain":                        true,
+	"application/x-www-form-urlencoded": true,
+}
+
+func mediaType(s string) string {
+	t, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	return t
+}
+
+// requestCodec returns the codec of the request body by Content-Type, or
+// replies 415 if it is not supported.
+func (ctx *httpCtx) requestCodec() (*codec.Codec, bool) {
+	t := mediaType(ctx.r.Header.Get("Content-Type"))
+	if jsonTypes[t] || strings.HasSuffix(t, "+json") {
+		return codec.JSON, true
+	}
+	if c := codec.ByMediaType(t); c != nil {
+		return c, true
+	}
+	ctx.statusText(http.StatusUnsupportedMediaType)
+	return nil, false
+}
+
+// decodeBody parses the request body as a JSON value, or an array of rows.
+// Raw is the JSON text of the value.
+func (ctx *httpCtx) decodeBody(data []byte) (raw []byte, v interface{}, ok bool) {
+	var err error
+	if f := ctx.requestRows(); f != "" {
+		v, err = decodeRows(f, data)
+	} else {
+		c, ok := ctx.requestCodec()
+		if !ok {
+			return nil, nil, false
+		}
+		if c == codec.JSON {
+			v, ok = ctx.parseJSON(data)
+			return data, v, ok
+		}
+		v, err = c.Decode(data)
+	}
+	if err != nil {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	if raw, err = json.Marshal(v); err != nil {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	return raw, v, true
+}
+
+type acceptRange struct {
+	typ string
+	q   float64
+}
+
+// accepts parses the Accept header, by descending quality.
+func (ctx *httpCtx) accepts() []acceptRange {
+	var res []acceptRange
+	for _, h := range ctx.r.Header.Values("Accept") {
+		for _, s := range strings.Split(h, ",") {
+			t, params, err := mime.ParseMediaType(s)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+			if q > 0 {
+				res = append(res, acceptRange{typ: t, q: q})
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].q > res[j].q })
+	return res
+}
+
+// responseCodec returns the codec of the response by Accept, or nil if no
+// format is acceptable.
+func (ctx *httpCtx) responseCodec() *codec.Codec {
+	if len(ctx.r.Header.Values("Accept")) == 0 {
+		return codec.JSON
+	}
+	for _, a := range ctx.accepts() {
+		if c := codec.ByMediaType(a.typ); c != nil {
+			return c
+		}
+		if a.typ == "*/*" {
+			return codec.JSON
+		}
+		if strings.HasSuffix(a.typ, "/*") {
+			for _, c := range codec.All {
+				for _, t := range c.MediaTypes {
+					if strings.HasPrefix(t, strings.TrimSuffix(a.typ, "*")) {
+						return c
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
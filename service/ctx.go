@@ -1,14 +1,16 @@
 package service
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/disksing/luson/codec"
 	"github.com/disksing/luson/jsonp"
-	"github.com/disksing/luson/key"
+	"github.com/disksing/luson/jsonstore"
 	"github.com/disksing/luson/util"
 	"github.com/unrolled/render"
 )
@@ -46,7 +48,7 @@ func (ctx *httpCtx) readBody() ([]byte, bool) {
 }
 
 func (ctx *httpCtx) unmarshalJSON(data []byte, v interface{}) bool {
-	err := json.Unmarshal(data, v)
+	err := jsonp.Unmarshal(data, v)
 	if err != nil {
 		ctx.text(http.StatusBadRequest, err.Error())
 		return false
@@ -60,16 +62,13 @@ func (ctx *httpCtx) parseJSON(data []byte) (interface{}, bool) {
 	return v, ok
 }
 
+// readJSON reads the request body in the format of Content-Type.
 func (ctx *httpCtx) readJSON() ([]byte, interface{}, bool) {
 	data, ok := ctx.readBody()
 	if !ok {
 		return nil, nil, false
 	}
-	v, ok := ctx.parseJSON(data)
-	if !ok {
-		return data, nil, false
-	}
-	return data, v, true
+	return ctx.decodeBody(data)
 }
 
 // returns v, empty, ok
@@ -81,7 +80,7 @@ func (ctx *httpCtx) readJSONEx() (interface{}, bool, bool) {
 	if len(data) == 0 {
 		return nil, true, true
 	}
-	v, ok := ctx.parseJSON(data)
+	_, v, ok := ctx.decodeBody(data)
 	if !ok {
 		return nil, false, false
 	}
@@ -100,8 +99,8 @@ func (ctx *httpCtx) uriPointer() (string, string, bool) {
 	}
 	for _, s := range strings.Split(path, "/") {
 		if id == "" {
-			if !util.IsUUID(s) {
-				ctx.text(http.StatusBadRequest, "expected UUID in request URL")
+			if !util.IsID(s) {
+				ctx.text(http.StatusBadRequest, "expected id in request URL")
 				return "", "", false
 			}
 			id = s
@@ -126,12 +125,133 @@ func (ctx *httpCtx) statusText(status int) {
 	ctx.text(status, http.StatusText(status))
 }
 
+// json replies a value in the format of Accept. Successful responses are 406
+// if no format is acceptable, errors fall back to JSON.
 func (ctx *httpCtx) json(status int, v interface{}) {
+	ctx.w.Header().Add("Vary", "Accept")
+	c := ctx.responseCodec()
+	if c == nil {
+		if status < http.StatusBadRequest {
+			ctx.statusText(http.StatusNotAcceptable)
+			return
+		}
+		c = codec.JSON
+	}
+	if c != codec.JSON {
+		data, err := c.Encode(v)
+		if err == nil {
+			ctx.w.Header().Set("Content-Type", c.MediaTypes[0])
+			ctx.w.WriteHeader(status)
+			_, _ = ctx.w.Write(data)
+			return
+		}
+		if status < http.StatusBadRequest {
+			ctx.text(http.StatusNotAcceptable, err.Error())
+			return
+		}
+	}
 	_ = ctx.render.JSON(ctx.w, status, v)
 }
 
-func (ctx *httpCtx) checkAPIKey(apiKey key.APIKey) bool {
-	return ctx.r.Header.Get("Authorization") == string(apiKey)
+// preconditions holds the conditional request headers, see RFC 7232.
+type preconditions struct {
+	ifMatch           []string // nil if absent, empty for "*"
+	ifNoneMatch       []string // nil if absent, empty for "*"
+	ifModifiedSince   time.Time
+	ifUnmodifiedSince time.Time
+}
+
+func (ctx *httpCtx) preconditions() *preconditions {
+	pc := &preconditions{
+		ifMatch:     ctx.etags("If-Match"),
+		ifNoneMatch: ctx.etags("If-None-Match"),
+	}
+	// Invalid dates are ignored as required by RFC 7232.
+	if t, err := http.ParseTime(ctx.r.Header.Get("If-Modified-Since")); err == nil {
+		pc.ifModifiedSince = t
+	}
+	if t, err := http.ParseTime(ctx.r.Header.Get("If-Unmodified-Since")); err == nil {
+		pc.ifUnmodifiedSince = t
+	}
+	return pc
+}
+
+// etags parses a list of entity tags. Weak tags are compared as strong ones,
+// since a document has a single representation.
+func (ctx *httpCtx) etags(header string) []string {
+	values := ctx.r.Header.Values(header)
+	if len(values) == 0 {
+		return nil
+	}
+	tags := []string{}
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				return []string{}
+			}
+			if tag != "" {
+				tags = append(tags, strings.Trim(strings.TrimPrefix(tag, "W/"), `"`))
+			}
+		}
+	}
+	return tags
+}
+
+// notModified reports whether a GET request can be answered with 304.
+func (pc *preconditions) notModified(info jsonstore.Info) bool {
+	if pc.ifNoneMatch != nil {
+		return len(pc.ifNoneMatch) == 0 || containsTag(pc.ifNoneMatch, info.Hash)
+	}
+	if !pc.ifModifiedSince.IsZero() && !info.LastModify.IsZero() {
+		return !info.LastModify.Truncate(time.Second).After(pc.ifModifiedSince)
+	}
+	return false
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// setVersion writes the validators of a document version.
+func (ctx *httpCtx) setVersion(info jsonstore.Info) {
+	ctx.w.Header().Set("ETag", `"`+info.Hash+`"`)
+	if info.Version > 0 {
+		ctx.w.Header().Set("X-Version", strconv.FormatInt(info.Version, 10))
+	}
+	if !info.LastModify.IsZero() {
+		ctx.w.Header().Set("Last-Modified", info.LastModify.UTC().Format(http.TimeFormat))
+	}
+}
+
+// origin describes the request for the revision history. The history is open
+// to all readers, so the query, which may hold a share token, and the client
+// address are left out.
+func (ctx *httpCtx) origin() *jsonstore.Origin {
+	return &jsonstore.Origin{
+		Method: ctx.r.Method,
+		URI:    ctx.r.URL.EscapedPath(),
+	}
+}
+
+// apiKey returns the credential in the Authorization header, either bare or
+// as a bearer token.
+func (ctx *httpCtx) apiKey() string {
+	return strings.TrimPrefix(ctx.r.Header.Get("Authorization"), "Bearer ")
+}
+
+// shareToken returns the share token in the `token` query parameter or the
+// Authorization header.
+func (ctx *httpCtx) shareToken() string {
+	if t := ctx.r.URL.Query().Get("token"); t != "" {
+		return t
+	}
+	return ctx.apiKey()
 }
 
 func (ctx *httpCtx) probeMergeType(v interface{}) string {
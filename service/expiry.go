@@ -0,0 +1,101 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/disksing/luson/metastore"
+	"go.uber.org/zap"
+)
+
+// readExpiry sets the expiry of a document to create from the query, either
+// ttl, a duration like 30m, or expires, an RFC 3339 time. With sliding, reads
+// and writes push the expiry to ttl later.
+func (ctx *httpCtx) readExpiry(m *metastore.MetaData) bool {
+	q := ctx.r.URL.Query()
+	_, sliding := q["sliding"]
+	ttl, at := q.Get("ttl"), q.Get("expires")
+	switch {
+	case ttl != "" && at != "":
+		ctx.text(http.StatusBadRequest, "ttl and expires are exclusive")
+		return false
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			ctx.text(http.StatusBadRequest, "invalid ttl "+ttl)
+			return false
+		}
+		expires := m.Created.Add(d)
+		m.Expires = &expires
+		if sliding {
+			m.SlidingTTL = d
+		}
+	case at != "":
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			ctx.text(http.StatusBadRequest, "invalid time "+at)
+			return false
+		}
+		m.Expires = &t
+	}
+	if sliding && m.SlidingTTL == 0 {
+		ctx.text(http.StatusBadRequest, "sliding expiry requires ttl")
+		return false
+	}
+	return true
+}
+
+// sweepLoop deletes expired documents every SweepInterval until Close.
+func (js *JServer) sweepLoop() {
+	defer js.wg.Done()
+	ticker := time.NewTicker(js.conf.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			js.sweep()
+		case <-js.done:
+			return
+		}
+	}
+}
+
+func (js *JServer) sweep() {
+	for _, id := range js.mstore.Expired(time.Now()) {
+		if err := js.expire(id); err != nil {
+			js.logger.Error("failed to delete expired document", zap.String("cmd", "sweep"), zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// expire deletes a document if it is expired. The data is removed from the
+// json store, which notifies its watchers, before the meta data, both while
+// the id cannot be created again.
+func (js *JServer) expire(id string) error {
+	deleted, err := js.mstore.DeleteExpired(id, time.Now(), func() error {
+		return js.jstore.Delete(id)
+	})
+	if err != nil || !deleted {
+		return err
+	}
+	js.schemas.remove(id)
+	js.logger.Info("expire", zap.String("id", id))
+	return nil
+}
+
+// slide pushes the expiry of an accessed document with sliding expiry.
+func (js *JServer) slide(mdata *metastore.MetaData) {
+	if mdata.SlidingTTL == 0 {
+		return
+	}
+	if err := js.mstore.Slide(mdata.ID, time.Now()); err != nil {
+		js.logger.Error("failed to push expiry", zap.String("cmd", "slide"), zap.String("id", mdata.ID), zap.Error(err))
+	}
+}
+
+// Close stops the background work of the service, and waits for it to
+// finish.
+func (js *JServer) Close() {
+	close(js.done)
+	js.wg.Wait()
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/jsonstore"
+)
+
+// change is a committed version of a document.
+type change struct {
+	value   interface{}
+	info    jsonstore.Info
+	deleted bool
+}
+
+// subscriber watches a document. Changes which are not consumed yet are
+// coalesced, the subscriber only needs the latest one to catch up.
+type subscriber struct {
+	sync.Mutex
+	pending *change
+	notify  chan struct{}
+}
+
+func (s *subscriber) push(c *change) {
+	s.Lock()
+	s.pending = c
+	s.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() *change {
+	s.Lock()
+	defer s.Unlock()
+	c := s.pending
+	s.pending = nil
+	return c
+}
+
+// feed dispatches committed changes to subscribers.
+type feed struct {
+	sync.Mutex
+	subs map[string]map[*subscriber]struct{}
+}
+
+func newFeed() *feed {
+	return &feed{subs: make(map[string]map[*subscriber]struct{})}
+}
+
+func (f *feed) subscribe(id string) *subscriber {
+	s := &subscriber{notify: make(chan struct{}, 1)}
+	f.Lock()
+	defer f.Unlock()
+	if f.subs[id] == nil {
+		f.subs[id] = make(map[*subscriber]struct{})
+	}
+	f.subs[id][s] = struct{}{}
+	return s
+}
+
+func (f *feed) unsubscribe(id string, s *subscriber) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.subs[id], s)
+	if len(f.subs[id]) == 0 {
+		delete(f.subs, id)
+	}
+}
+
+func (f *feed) watched(id string) bool {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.subs[id]) > 0
+}
+
+func (f *feed) publish(id string, c *change) {
+	f.Lock()
+	defer f.Unlock()
+	for s := range f.subs[id] {
+		s.push(c)
+	}
+}
+
+const feedHeartbeat = 30 * time.Second
+
+// eventID identifies a document version in the event stream. The version
+// number is used if the history is enabled, the hash otherwise.
+func eventID(info jsonstore.Info) string {
+	if info.Version > 0 {
+		return strconv.FormatInt(info.Version, 10)
+	}
+	return info.Hash
+}
+
+// feedEvent is the data of a `value` event, or a `patch` event if Patch is
+// not nil.
+type feedEvent struct {
+	ETag  string
+	Value interface{}
+	Patch []jsonp.Operation
+}
+
+// acceptEventStream reports whether the client asks for Server-Sent Events.
+func (ctx *httpCtx) acceptEventStream() bool {
+	for _, v := range ctx.r.Header.Values("Accept") {
+		if strings.Contains(v, "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// watch streams changes of the value under the pointer as Server-Sent
+// Events. The current value is sent first, then each change is sent either as
+// the full value, or as a JSON Patch against the last event if the `diff`
+// parameter is present. A `Last-Event-ID` header resumes the stream.
+func (js *JServer) watch(ctx *httpCtx, id, p string) {
+	flusher, ok := ctx.w.(http.Flusher)
+	if !ok {
+		ctx.text(http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	_, diff := ctx.r.URL.Query()["diff"]
+
+	// Subscribe before reading the current value, so no change is missed.
+	sub := js.feed.subscribe(id)
+	defer js.feed.unsubscribe(id, sub)
+
+	v, info, err := js.jstore.Get(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	last, _ := jsonp.Get(v, p)
+
+	h := ctx.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	ctx.w.WriteHeader(http.StatusOK)
+
+	lastID := ctx.r.Header.Get("Last-Event-ID")
+	if lastID != eventID(info) {
+		var ev *feedEvent
+		if diff {
+			if old := js.resumeValue(id, p, lastID); old != nil {
+				ev = &feedEvent{ETag: info.Hash, Patch: append([]jsonp.Operation{}, jsonp.Diff(*old, last)...)}
+			}
+		}
+		if ev == nil {
+			ev = &feedEvent{ETag: info.Hash, Value: last}
+		}
+		if !writeEvent(ctx.w, eventID(info), ev) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.notify:
+			c := sub.pop()
+			if c == nil {
+				continue
+			}
+			if c.deleted {
+				fmt.Fprint(ctx.w, "event: delete\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			cur, _ := jsonp.Get(c.value, p)
+			if reflect.DeepEqual(cur, last) {
+				continue
+			}
+			ev := &feedEvent{ETag: c.info.Hash, Value: cur}
+			if diff {
+				ev = &feedEvent{ETag: c.info.Hash, Patch: jsonp.Diff(last, cur)}
+			}
+			if !writeEvent(ctx.w, eventID(c.info), ev) {
+				return
+			}
+			flusher.Flush()
+			last = cur
+		}
+	}
+}
+
+// resumeValue returns the value under the pointer of the version the client
+// has seen, or nil if it is not recorded.
+func (js *JServer) resumeValue(id, p, lastID string) *interface{} {
+	version, err := strconv.ParseInt(lastID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	rev, err := js.jstore.Revision(id, version)
+	if err != nil || rev == nil {
+		return nil
+	}
+	v, _ := jsonp.Get(rev.Value, p)
+	return &v
+}
+
+func writeEvent(w http.ResponseWriter, id string, ev *feedEvent) bool {
+	event := "value"
+	var data []byte
+	var err error
+	if ev.Patch != nil {
+		event = "patch"
+		data, err = json.Marshal(map[string]interface{}{"etag": ev.ETag, "patch": ev.Patch})
+	} else {
+		data, err = json.Marshal(map[string]interface{}{"etag": ev.ETag, "value": ev.Value})
+	}
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err == nil
+}
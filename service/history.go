@@ -0,0 +1,150 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/jsonstore"
+	"github.com/gorilla/mux"
+)
+
+// revisionQuery parses the `version` or `at` query parameter of time-travel
+// reads. It returns false if neither is given.
+func (ctx *httpCtx) revisionQuery() (version int64, at time.Time, has bool, ok bool) {
+	q := ctx.r.URL.Query()
+	if s := q.Get("version"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			ctx.text(http.StatusBadRequest, "invalid version "+s)
+			return 0, time.Time{}, false, false
+		}
+		return v, time.Time{}, true, true
+	}
+	if s := q.Get("at"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			ctx.text(http.StatusBadRequest, "invalid time "+s)
+			return 0, time.Time{}, false, false
+		}
+		return 0, t, true, true
+	}
+	return 0, time.Time{}, false, true
+}
+
+func (js *JServer) getRevision(ctx *httpCtx, id string, version int64, at time.Time) (*jsonstore.Revision, bool) {
+	var rev *jsonstore.Revision
+	var err error
+	if at.IsZero() {
+		rev, err = js.jstore.Revision(id, version)
+	} else {
+		rev, err = js.jstore.RevisionAt(id, at)
+	}
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if rev == nil {
+		ctx.text(http.StatusNotFound, "revision not found")
+		return nil, false
+	}
+	return rev, true
+}
+
+// getOld handles GET requests which read a prior revision.
+func (js *JServer) getOld(ctx *httpCtx, id, p string, version int64, at time.Time, opts *readOptions) {
+	rev, ok := js.getRevision(ctx, id, version, at)
+	if !ok {
+		return
+	}
+	v, err := jsonp.Get(rev.Value, p)
+	if err != nil {
+		ctx.text(http.StatusNotAcceptable, err.Error())
+		return
+	}
+	ctx.setVersion(jsonstore.Info{Version: rev.Version, Hash: rev.Hash, LastModify: rev.Time})
+	opts.reply(ctx, v)
+}
+
+type revisionInfo struct {
+	Version int64             `json:"version"`
+	Hash    string            `json:"hash"`
+	Time    time.Time         `json:"time"`
+	Origin  *jsonstore.Origin `json:"origin,omitempty"`
+}
+
+// History handles requests listing the revisions of a document.
+func (js *JServer) History(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.checkMetaForRead(ctx, id, "") {
+		return
+	}
+	revs, err := js.jstore.History(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	res := make([]revisionInfo, 0, len(revs))
+	for _, rev := range revs {
+		res = append(res, revisionInfo{
+			Version: rev.Version,
+			Hash:    rev.Hash,
+			Time:    rev.Time,
+			Origin:  rev.Origin,
+		})
+	}
+	ctx.json(http.StatusOK, res)
+}
+
+// Revert handles requests rolling a document back to a prior revision. The
+// revision is chosen by the `version` or `at` parameter, either in the query
+// or in the JSON body.
+func (js *JServer) Revert(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+
+	version, at, has, ok := ctx.revisionQuery()
+	if !ok {
+		return
+	}
+	if !has {
+		var req struct {
+			Version *int64    `json:"version"`
+			At      time.Time `json:"at"`
+		}
+		data, ok := ctx.readBody()
+		if !ok || !ctx.unmarshalJSON(data, &req) {
+			return
+		}
+		if req.Version == nil && req.At.IsZero() {
+			ctx.text(http.StatusBadRequest, "expect version or at")
+			return
+		}
+		if req.Version != nil {
+			version = *req.Version
+		}
+		at = req.At
+	}
+
+	if !js.checkMetaForWrite(ctx, id, "") {
+		return
+	}
+	rev, ok := js.getRevision(ctx, id, version, at)
+	if !ok {
+		return
+	}
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		if !js.withPreconditions(ctx, txn, id) {
+			return false
+		}
+		txn.Put(id, rev.Value)
+		return true
+	})
+	if !ok {
+		return
+	}
+	js.setResult(ctx, txn, id)
+	ctx.statusText(http.StatusOK)
+}
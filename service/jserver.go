@@ -2,8 +2,11 @@ package service
 
 import (
 	"fmt"
+	"math/rand"
 	"net/http"
-	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/disksing/luson/config"
 	"github.com/disksing/luson/jsonp"
@@ -11,34 +14,50 @@ import (
 	"github.com/disksing/luson/key"
 	"github.com/disksing/luson/metastore"
 	"github.com/disksing/luson/util"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 // JServer services JSON data.
 type JServer struct {
-	logger *util.Logger
-	mstore *metastore.Store
-	jstore *jsonstore.Store
-	conf   *config.Config
-	apiKey key.APIKey
+	logger  *util.Logger
+	mstore  *metastore.Store
+	jstore  *jsonstore.Store
+	conf    *config.Config
+	keys    *key.Registry
+	signer  *key.Signer
+	feed    *feed
+	schemas *schemaCache
+	done    chan struct{}
+	wg      sync.WaitGroup
 }
 
 // NewJServer creates the JSON service handler.
-func NewJServer(mstore *metastore.Store, jstore *jsonstore.Store, apiKey key.APIKey, conf *config.Config, logger *util.Logger) *JServer {
-	return &JServer{
-		logger: logger,
-		mstore: mstore,
-		jstore: jstore,
-		conf:   conf,
-		apiKey: apiKey,
-	}
+func NewJServer(mstore *metastore.Store, jstore *jsonstore.Store, keys *key.Registry, signer *key.Signer, conf *config.Config, logger *util.Logger) *JServer {
+	js := &JServer{
+		logger:  logger,
+		mstore:  mstore,
+		jstore:  jstore,
+		conf:    conf,
+		keys:    keys,
+		signer:  signer,
+		feed:    newFeed(),
+		schemas: newSchemaCache(),
+		done:    make(chan struct{}),
+	}
+	jstore.SetListener(js.changed)
+	if conf.SweepInterval > 0 {
+		js.wg.Add(1)
+		go js.sweepLoop()
+	}
+	return js
 }
 
 // Create handles JSON POST requests.
 func (js *JServer) Create(w http.ResponseWriter, r *http.Request) {
 	ctx := newCtx(w, r)
 
-	if js.conf.DefaultAccess != config.Public && !ctx.checkAPIKey(js.apiKey) {
+	if js.conf.DefaultAccess != config.Public && !js.authorized(ctx, key.ScopeCreate, "") {
 		ctx.statusText(http.StatusUnauthorized)
 		return
 	}
@@ -47,6 +66,10 @@ func (js *JServer) Create(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	mdata := &metastore.MetaData{Access: js.conf.DefaultAccess, Created: time.Now()}
+	if !ctx.readExpiry(mdata) {
+		return
+	}
 
 	id, err := js.mstore.Create()
 	if err != nil {
@@ -54,18 +77,21 @@ func (js *JServer) Create(w http.ResponseWriter, r *http.Request) {
 		ctx.text(http.StatusInternalServerError, "failed to create meta")
 		return
 	}
-	err = js.mstore.Put(&metastore.MetaData{ID: id, Access: js.conf.DefaultAccess})
+	mdata.ID = id
+	err = js.mstore.Put(mdata)
 	if err != nil {
 		js.logger.Error("failed to put meta", zap.String("cmd", "create"), zap.String("id", id), zap.Error(err))
 		ctx.text(http.StatusInternalServerError, "failed to write meta")
 		return
 	}
-	err = js.jstore.Put(id, v)
-	if err != nil {
-		js.logger.Error("failed to put json data", zap.String("cmd", "create"), zap.String("id", id), zap.Error(err))
-		ctx.text(http.StatusInternalServerError, "failed to write json data")
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		txn.Put(id, v)
+		return true
+	})
+	if !ok {
 		return
 	}
+	js.setResult(ctx, txn, id)
 	js.logger.Info("create", zap.String("id", id))
 	ctx.text(http.StatusCreated, id)
 }
@@ -78,24 +104,46 @@ func (js *JServer) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !js.checkMetaForRead(ctx, id) {
+	if !js.checkMetaForRead(ctx, id, p) {
 		return
 	}
 
-	v, hash, err := js.jstore.Get(id)
+	version, at, old, ok := ctx.revisionQuery()
+	if !ok {
+		return
+	}
+	opts, ok := ctx.readOptions()
+	if !ok {
+		return
+	}
+	if old {
+		js.getOld(ctx, id, p, version, at, opts)
+		return
+	}
+	if ctx.acceptEventStream() {
+		js.watch(ctx, id, p)
+		return
+	}
+
+	v, info, err := js.jstore.Get(id)
 	if err != nil {
 		ctx.text(http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	ctx.setVersion(info)
+	if ctx.preconditions().notModified(info) {
+		ctx.w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	v, err = jsonp.Get(v, p)
 	if err != nil {
 		ctx.text(http.StatusNotAcceptable, err.Error())
 		return
 	}
 
-	ctx.w.Header().Add("ETag", hash)
-	ctx.json(http.StatusOK, v)
+	opts.reply(ctx, v)
 }
 
 // Put handles JSON PUT requests.
@@ -110,35 +158,99 @@ func (js *JServer) Put(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	if !js.checkMetaForWrite(ctx, id) {
+	mdata, err := js.mstore.Get(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if mdata == nil {
+		js.putCreate(ctx, id, p, v)
+		return
+	}
+
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		return js.put(ctx, txn, id, p, v)
+	})
+	if !ok {
 		return
 	}
+	js.setResult(ctx, txn, id)
+	ctx.text(http.StatusOK, "")
+}
 
-	var hash string
+// put replaces the node of a document in the transaction.
+func (js *JServer) put(ctx *httpCtx, txn *jsonstore.Txn, id, p string, v interface{}) bool {
+	if !js.checkMetaForWrite(ctx, id, p) || !js.withPreconditions(ctx, txn, id) {
+		return false
+	}
 	if p != "" {
-		var old interface{}
-		var err error
-		old, hash, err = js.jstore.Get(id)
-		if err != nil {
-			ctx.text(http.StatusInternalServerError, err.Error())
-			return
+		old, ok := js.txnGetForWrite(ctx, txn, id, p)
+		if !ok {
+			return false
 		}
-		v, err = jsonp.Replace(old, p, v)
+		t, err := old.Replace(p, v)
 		if err != nil {
 			ctx.text(http.StatusNotAcceptable, err.Error())
-			return
+			return false
 		}
+		v = t.Value()
+	}
+	txn.Put(id, v)
+	return true
+}
+
+// putCreate handles PUT requests to documents which do not exist, which
+// create the document with the id in the URL.
+func (js *JServer) putCreate(ctx *httpCtx, id, p string, v interface{}) {
+	// Callers which cannot create the document get what checkMeta replies
+	// for private documents, so they cannot tell if the id exists.
+	if p != "" || (js.conf.DefaultAccess != config.Public && !js.authorized(ctx, key.ScopeCreate, id)) {
+		ctx.text(http.StatusNotFound, id)
+		return
+	}
+	if !js.conf.ValidID(id) {
+		ctx.text(http.StatusBadRequest, "id not allowed: "+id)
+		return
+	}
+	if ctx.preconditions().ifMatch != nil {
+		// No tag matches, the document does not exist.
+		ctx.statusText(http.StatusPreconditionFailed)
+		return
+	}
+	mdata := &metastore.MetaData{ID: id, Access: js.conf.DefaultAccess, Created: time.Now()}
+	if !ctx.readExpiry(mdata) {
+		return
 	}
 
-	err := js.jstore.Put(id, v)
+	// An expired document which is not swept yet still takes the id.
+	err := js.expire(id)
+	if err == nil {
+		err = js.mstore.Insert(mdata)
+	}
+	if err == metastore.ErrExists {
+		// Created by a concurrent request.
+		if ctx.preconditions().ifNoneMatch != nil {
+			ctx.statusText(http.StatusPreconditionFailed)
+		} else {
+			ctx.statusText(http.StatusConflict)
+		}
+		return
+	}
 	if err != nil {
-		ctx.text(http.StatusInternalServerError, err.Error())
+		js.logger.Error("failed to put meta", zap.String("cmd", "create"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write meta")
 		return
 	}
-	if hash != "" {
-		ctx.w.Header().Add("ETag", hash)
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		txn.Put(id, v)
+		return true
+	})
+	if !ok {
+		return
 	}
-	ctx.text(http.StatusOK, "")
+	js.setResult(ctx, txn, id)
+	js.logger.Info("create", zap.String("id", id))
+	ctx.text(http.StatusCreated, id)
 }
 
 // Patch handles JSON PATCH requests.
@@ -160,52 +272,239 @@ func (js *JServer) Patch(w http.ResponseWriter, r *http.Request) {
 }
 
 func (js *JServer) mergePatch(ctx *httpCtx, id, p string, v interface{}) {
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		return js.mergePatchTxn(ctx, txn, id, p, v)
+	})
+	if !ok {
+		return
+	}
+	js.setResult(ctx, txn, id)
+	ctx.statusText(http.StatusOK)
+}
+
+// mergePatchTxn applies a JSON merge patch to the node of a document in the
+// transaction.
+func (js *JServer) mergePatchTxn(ctx *httpCtx, txn *jsonstore.Txn, id, p string, v interface{}) bool {
 	if id == "" {
 		ctx.text(http.StatusBadRequest, "expect resource id")
-		return
+		return false
+	}
+	if !js.checkMetaForWrite(ctx, id, p) || !js.withPreconditions(ctx, txn, id) {
+		return false
+	}
+	old, ok := js.txnGetForWrite(ctx, txn, id, p)
+	if !ok {
+		return false
 	}
 
-	if !js.checkMetaForWrite(ctx, id) {
+	t, err := old.Merge(p, v)
+	if err != nil {
+		ctx.text(http.StatusNotAcceptable, err.Error())
+		return false
+	}
+	txn.Put(id, t.Value())
+	return true
+}
+
+// Delete handles JSON DELETE requests.
+func (js *JServer) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id, p, ok := ctx.uriPointer()
+	if !ok {
 		return
 	}
 
-	old, hash, err := js.jstore.Get(id)
-	if err != nil {
-		ctx.text(http.StatusInternalServerError, err.Error())
+	if p == "" {
+		js.deleteDoc(ctx, id)
 		return
 	}
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		return js.delete(ctx, txn, id, p)
+	})
+	if !ok {
+		return
+	}
+	js.setResult(ctx, txn, id)
+	ctx.statusText(http.StatusOK)
+}
 
-	sub, err := jsonp.Get(old, p)
-	if err != nil {
-		ctx.text(http.StatusNotAcceptable, err.Error())
+// errResponded is returned through other packages by callbacks which have
+// responded to the request.
+var errResponded = errors.New("responded")
+
+// deleteDoc removes a document. The data and the meta data are deleted
+// together while the meta data is locked, so no reader sees one without the
+// other.
+func (js *JServer) deleteDoc(ctx *httpCtx, id string) {
+	if !js.checkMetaForWrite(ctx, id, "") {
 		return
 	}
-	v, err = jsonp.Replace(old, p, jsonp.Merge(sub, v))
+	// The meta data is locked, so the transaction must not read it.
+	err := js.mstore.DeleteWith(id, func() error {
+		_, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+			txn.Delete(id)
+			return js.withPreconditions(ctx, txn, id)
+		})
+		if !ok {
+			return errResponded
+		}
+		return nil
+	})
+	js.schemas.remove(id)
+	switch {
+	case err == errResponded:
+	case err == metastore.ErrNotFound:
+		ctx.text(http.StatusNotFound, id)
+	case err != nil:
+		js.logger.Error("failed to delete", zap.String("cmd", "delete"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to delete")
+	default:
+		js.logger.Info("delete", zap.String("id", id))
+		ctx.statusText(http.StatusOK)
+	}
+}
+
+// delete removes the node of a document in the transaction. The meta data
+// of removed documents is deleted by deleteMeta after commit.
+func (js *JServer) delete(ctx *httpCtx, txn *jsonstore.Txn, id, p string) bool {
+	if !js.checkMetaForWrite(ctx, id, p) || !js.withPreconditions(ctx, txn, id) {
+		return false
+	}
+	if p == "" {
+		txn.Delete(id)
+		return true
+	}
+
+	t, ok := js.txnGetForWrite(ctx, txn, id, p)
+	if !ok {
+		return false
+	}
+	t, _, err := t.Remove(p)
+	if errors.Cause(err) == jsonp.ErrNotFound {
+		ctx.text(http.StatusNotFound, err.Error())
+		return false
+	}
 	if err != nil {
-		ctx.text(http.StatusNotAcceptable, err.Error())
-		return
+		ctx.text(http.StatusBadRequest, err.Error())
+		return false
 	}
-	err = js.jstore.Put(id, v)
+	txn.Put(id, t.Value())
+	return true
+}
+
+func (js *JServer) deleteMeta(ctx *httpCtx, id string) bool {
+	err := js.mstore.Delete(id)
+	js.schemas.remove(id)
 	if err != nil {
-		ctx.text(http.StatusInternalServerError, err.Error())
-		return
+		js.logger.Error("failed to delete meta", zap.String("cmd", "delete"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to delete meta")
+		return false
 	}
-	if hash != "" {
-		ctx.w.Header().Add("ETag", hash)
+	js.logger.Info("delete", zap.String("id", id))
+	return true
+}
+
+// newTxn starts a transaction which writes on behalf of the request.
+func (js *JServer) newTxn(ctx *httpCtx) *jsonstore.Txn {
+	txn := js.jstore.NewTxn()
+	txn.SetOrigin(ctx.origin())
+	return txn
+}
+
+// withPreconditions turns the conditional request headers into conditions of
+// the transaction which writes the document.
+func (js *JServer) withPreconditions(ctx *httpCtx, txn *jsonstore.Txn, id string) bool {
+	pc := ctx.preconditions()
+	if len(pc.ifMatch) > 0 {
+		txn.IfMatchHash(id, pc.ifMatch...)
+	} else if pc.ifMatch == nil && !pc.ifUnmodifiedSince.IsZero() {
+		txn.IfUnmodifiedSince(id, pc.ifUnmodifiedSince)
+	}
+	if pc.ifNoneMatch != nil {
+		if len(pc.ifNoneMatch) == 0 {
+			// "*" never matches, the document exists.
+			ctx.statusText(http.StatusPreconditionFailed)
+			return false
+		}
+		txn.IfNoneMatchHash(id, pc.ifNoneMatch...)
 	}
-	ctx.statusText(http.StatusOK)
+	return true
 }
 
-func (js *JServer) txnGetForWrite(ctx *httpCtx, txn *jsonstore.Txn, id string) (interface{}, bool) {
-	return js.txnGet(ctx, txn, id, true)
+// setResult writes the validators of the document written by txn.
+func (js *JServer) setResult(ctx *httpCtx, txn *jsonstore.Txn, id string) {
+	if info, ok := txn.Result(id); ok {
+		ctx.setVersion(info)
+	}
 }
 
-func (js *JServer) txnGetForRead(ctx *httpCtx, txn *jsonstore.Txn, id string) (interface{}, bool) {
-	return js.txnGet(ctx, txn, id, false)
+// maxRetries is the number of times a transaction is built again when the
+// documents it read are changed by concurrent writes. Retries back off for a
+// random time up to retryBackoff, doubled each time, so that the writers of a
+// busy document take turns.
+const (
+	maxRetries      = 20
+	retryBackoff    = time.Millisecond
+	maxRetryBackoff = 100 * time.Millisecond
+)
+
+// update builds a transaction with fn, then validates and commits it. If a
+// document read by the transaction is changed by others before commit, fn
+// runs again on fresh snapshots, so concurrent updates are never lost. fn
+// responds and returns false on failures, as update does.
+func (js *JServer) update(ctx *httpCtx, fn func(txn *jsonstore.Txn) bool) (*jsonstore.Txn, bool) {
+	for i := 0; ; i++ {
+		txn := js.newTxn(ctx)
+		if !fn(txn) || !js.validate(ctx, txn) {
+			return nil, false
+		}
+		err := txn.Commit()
+		switch errors.Cause(err) {
+		case nil:
+			return txn, true
+		case jsonstore.ErrConflict:
+			if i < maxRetries {
+				backoff := retryBackoff << uint(i)
+				if backoff > maxRetryBackoff {
+					backoff = maxRetryBackoff
+				}
+				time.Sleep(time.Duration(rand.Int63n(int64(backoff))))
+				continue
+			}
+			ctx.statusText(http.StatusConflict)
+		case jsonstore.ErrConditionNotMatch:
+			ctx.statusText(http.StatusPreconditionFailed)
+		default:
+			ctx.text(http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
 }
 
-func (js *JServer) txnGet(ctx *httpCtx, txn *jsonstore.Txn, id string, mut bool) (interface{}, bool) {
-	if !js.checkMeta(ctx, id, mut) {
+// changed is called with each document written to the json store.
+func (js *JServer) changed(id string, v interface{}, info jsonstore.Info, deleted bool) {
+	if !deleted {
+		js.mstore.Touch(id, info.LastModify, info.Size, info.Hash)
+	}
+	if js.feed.watched(id) {
+		js.feed.publish(id, &change{value: v, info: info, deleted: deleted})
+	}
+}
+
+// txnGetForWrite returns the document as a tree to update, which copies
+// only the nodes on the way to the changes, so the snapshot shared by
+// readers is kept.
+func (js *JServer) txnGetForWrite(ctx *httpCtx, txn *jsonstore.Txn, id, p string) (jsonp.Tree, bool) {
+	v, ok := js.txnGet(ctx, txn, id, p, true)
+	return jsonp.NewTree(v), ok
+}
+
+func (js *JServer) txnGetForRead(ctx *httpCtx, txn *jsonstore.Txn, id, p string) (interface{}, bool) {
+	return js.txnGet(ctx, txn, id, p, false)
+}
+
+func (js *JServer) txnGet(ctx *httpCtx, txn *jsonstore.Txn, id, p string, mut bool) (interface{}, bool) {
+	if !js.checkMeta(ctx, id, p, mut) {
 		return nil, false
 	}
 	v, err := txn.Get(id)
@@ -213,127 +512,150 @@ func (js *JServer) txnGet(ctx *httpCtx, txn *jsonstore.Txn, id string, mut bool)
 		ctx.text(http.StatusInternalServerError, "failed to load JSON, id="+id)
 		return nil, false
 	}
-	if mut {
-		v = jsonp.Clone(v)
-	}
 	return v, true
 }
 
 func (js *JServer) jsonPatch(ctx *httpCtx, id, basePath string, data []byte) {
-	ps, ok := js.readJSONPatch(ctx, id, basePath, data)
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		return js.jsonPatchTxn(ctx, txn, id, basePath, data)
+	})
 	if !ok {
 		return
 	}
-	txn := js.jstore.NewTxn()
+	js.setResult(ctx, txn, id)
+	ctx.statusText(http.StatusOK)
+}
+
+// jsonPatchTxn applies a JSON Patch to documents in the transaction.
+func (js *JServer) jsonPatchTxn(ctx *httpCtx, txn *jsonstore.Txn, id, basePath string, data []byte) bool {
+	ps, ok := js.readJSONPatch(ctx, id, basePath, data)
+	if !ok {
+		return false
+	}
+	if !js.checkMetaForRead(ctx, id, basePath) || !js.withPreconditions(ctx, txn, id) {
+		return false
+	}
 	for _, p := range ps {
 		switch p.Op {
 		case "test":
-			v, ok := js.txnGetForRead(ctx, txn, p.id)
+			v, ok := js.txnGetForRead(ctx, txn, p.id, p.Path)
 			if !ok {
-				return
+				return false
 			}
-			if !reflect.DeepEqual(v, p.Value) {
+			v, err := jsonp.Get(v, p.Path)
+			if err != nil || !jsonp.Equal(v, p.Value) {
 				ctx.text(http.StatusPreconditionFailed, "value does not match")
-				return
+				return false
 			}
 		case "remove":
-			v, ok := js.txnGetForWrite(ctx, txn, p.id)
+			t, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 			if !ok {
-				return
+				return false
 			}
-			v, err := jsonp.Remove(v, p.Path)
+			t, _, err := t.Remove(p.Path)
 			if err != nil {
 				ctx.text(http.StatusBadRequest, err.Error())
-				return
+				return false
 			}
-			txn.Put(p.id, v)
+			txn.Put(p.id, t.Value())
 		case "add":
-			v, ok := js.txnGetForWrite(ctx, txn, p.id)
+			t, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 			if !ok {
-				return
+				return false
 			}
-			v, err := jsonp.Add(v, p.Path, p.Value)
+			t, err := t.Add(p.Path, p.Value)
 			if err != nil {
 				ctx.text(http.StatusBadRequest, err.Error())
-				return
+				return false
 			}
-			txn.Put(p.id, v)
+			txn.Put(p.id, t.Value())
 		case "replace":
-			v, ok := js.txnGetForWrite(ctx, txn, p.id)
+			t, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 			if !ok {
-				return
+				return false
 			}
-			v, err := jsonp.Replace(v, p.Path, p.Value)
+			t, err := t.Replace(p.Path, p.Value)
 			if err != nil {
 				ctx.text(http.StatusBadRequest, err.Error())
-				return
+				return false
 			}
-			txn.Put(p.id, v)
+			txn.Put(p.id, t.Value())
 		case "move":
 			if p.id == p.fromID {
-				v, ok := js.txnGetForWrite(ctx, txn, p.id)
+				if !js.checkMetaForWrite(ctx, p.id, p.From) {
+					return false
+				}
+				t, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 				if !ok {
-					return
+					return false
 				}
-				v, err := jsonp.Move(v, p.From, p.Path)
+				t, err := t.Move(p.From, p.Path)
 				if err != nil {
 					ctx.text(http.StatusBadRequest, err.Error())
-					return
+					return false
 				}
-				txn.Put(p.id, v)
+				txn.Put(p.id, t.Value())
 			} else {
-				from, ok := js.txnGetForWrite(ctx, txn, p.fromID)
+				from, ok := js.txnGetForWrite(ctx, txn, p.fromID, p.From)
 				if !ok {
-					return
+					return false
 				}
-				to, ok := js.txnGetForWrite(ctx, txn, p.id)
+				to, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 				if !ok {
-					return
+					return false
 				}
-				from, to, err := jsonp.Move2(from, to, p.From, p.Path)
+				from, v, err := from.Remove(p.From)
 				if err != nil {
 					ctx.text(http.StatusBadRequest, err.Error())
-					return
+					return false
 				}
-				txn.Put(p.fromID, from)
-				txn.Put(p.id, to)
+				to, err = to.Add(p.Path, v)
+				if err != nil {
+					ctx.text(http.StatusBadRequest, err.Error())
+					return false
+				}
+				txn.Put(p.fromID, from.Value())
+				txn.Put(p.id, to.Value())
 			}
 		case "copy":
 			if p.id == p.fromID {
-				v, ok := js.txnGetForWrite(ctx, txn, p.id)
+				if !js.checkMetaForRead(ctx, p.id, p.From) {
+					return false
+				}
+				t, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 				if !ok {
-					return
+					return false
 				}
-				v, err := jsonp.Copy(v, p.From, p.Path)
+				t, err := t.Copy(p.From, p.Path)
 				if err != nil {
 					ctx.text(http.StatusBadRequest, err.Error())
-					return
+					return false
 				}
-				txn.Put(p.id, v)
+				txn.Put(p.id, t.Value())
 			} else {
-				from, ok := js.txnGetForRead(ctx, txn, p.fromID)
+				from, ok := js.txnGetForRead(ctx, txn, p.fromID, p.From)
 				if !ok {
-					return
+					return false
 				}
-				to, ok := js.txnGetForWrite(ctx, txn, p.id)
+				to, ok := js.txnGetForWrite(ctx, txn, p.id, p.Path)
 				if !ok {
-					return
+					return false
 				}
-				to, err := jsonp.Copy2(from, to, p.From, p.Path)
+				v, err := jsonp.Get(from, p.From)
 				if err != nil {
 					ctx.text(http.StatusBadRequest, err.Error())
-					return
+					return false
 				}
-				txn.Put(p.id, to)
+				to, err = to.Add(p.Path, v)
+				if err != nil {
+					ctx.text(http.StatusBadRequest, err.Error())
+					return false
+				}
+				txn.Put(p.id, to.Value())
 			}
 		}
 	}
-	err := txn.Commit()
-	if err != nil {
-		ctx.statusText(http.StatusPreconditionFailed)
-		return
-	}
-	ctx.statusText(http.StatusOK)
+	return true
 }
 
 type jsonPatch struct {
@@ -373,22 +695,39 @@ func (js *JServer) readJSONPatch(ctx *httpCtx, id, basePath string, data []byte)
 }
 
 func (js *JServer) adjustPath(ctx *httpCtx, id, basePath, path, typ string) (string, string, bool) {
+	if path != "" && path[0] == '@' {
+		// start with alias
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			i = len(path)
+		}
+		target, ok := js.resolveID(path[:i])
+		if !ok {
+			ctx.text(http.StatusBadRequest, fmt.Sprintf("unknown alias in %s `%s`", typ, path))
+			return "", "", false
+		}
+		return target, path[i:], true
+	}
 	if path != "" && path[0] != '/' {
-		// start with UUID
-		if len(path) < util.UUIDLen || !util.IsUUID(path[:util.UUIDLen]) {
-			ctx.text(http.StatusBadRequest, fmt.Sprintf("expect uuid in %s `%s`", typ, path))
+		// start with id
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			i = len(path)
+		}
+		if !util.IsID(path[:i]) {
+			ctx.text(http.StatusBadRequest, fmt.Sprintf("expect id in %s `%s`", typ, path))
 			return "", "", false
 		}
-		return path[:util.UUIDLen], path[util.UUIDLen:], true
+		return path[:i], path[i:], true
 	}
 	if id == "" {
-		ctx.text(http.StatusBadRequest, fmt.Sprintf("expect uuid in %s `%s`", typ, path))
+		ctx.text(http.StatusBadRequest, fmt.Sprintf("expect id in %s `%s`", typ, path))
 		return "", "", false
 	}
 	return id, basePath + path, true
 }
 
-func (js *JServer) checkMeta(ctx *httpCtx, id string, mut bool) (ok bool) {
+func (js *JServer) checkMeta(ctx *httpCtx, id, p string, mut bool) (ok bool) {
 	mdata, err := js.mstore.Get(id)
 	if err != nil {
 		ctx.text(http.StatusInternalServerError, err.Error())
@@ -398,21 +737,40 @@ func (js *JServer) checkMeta(ctx *httpCtx, id string, mut bool) (ok bool) {
 		ctx.text(http.StatusNotFound, id)
 		return
 	}
-	if mdata.Access == config.Private && !ctx.checkAPIKey(js.apiKey) {
-		ctx.text(http.StatusNotFound, id)
-		return
+	defer func() {
+		if ok {
+			js.slide(mdata)
+		}
+	}()
+	if mdata.Access == config.Public || (!mut && mdata.Access == config.Protected) {
+		return true
+	}
+	scope := key.ScopeRead
+	if mut {
+		scope = key.ScopeWrite
 	}
-	if mut && mdata.Access == config.Protected && !ctx.checkAPIKey(js.apiKey) {
-		ctx.text(http.StatusUnauthorized, id)
+	if js.authorized(ctx, scope, id) || js.shared(ctx, mdata, p) {
+		return true
+	}
+	if mdata.Access == config.Private {
+		ctx.text(http.StatusNotFound, id)
 		return
 	}
-	return true
+	ctx.text(http.StatusUnauthorized, id)
+	return
+}
+
+// authorized reports if the api key of the request grants scope on the
+// document.
+func (js *JServer) authorized(ctx *httpCtx, scope, id string) bool {
+	k := js.keys.Authenticate(ctx.apiKey())
+	return k != nil && k.Allows(scope, id)
 }
 
-func (js *JServer) checkMetaForRead(ctx *httpCtx, id string) bool {
-	return js.checkMeta(ctx, id, false)
+func (js *JServer) checkMetaForRead(ctx *httpCtx, id, p string) bool {
+	return js.checkMeta(ctx, id, p, false)
 }
 
-func (js *JServer) checkMetaForWrite(ctx *httpCtx, id string) bool {
-	return js.checkMeta(ctx, id, true)
+func (js *JServer) checkMetaForWrite(ctx *httpCtx, id, p string) bool {
+	return js.checkMeta(ctx, id, p, true)
 }
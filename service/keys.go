@@ -0,0 +1,97 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/disksing/luson/key"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type keyRequest struct {
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes"`
+	Docs    []string   `json:"docs"`
+	Expires *time.Time `json:"expires"`
+}
+
+type keyResult struct {
+	key.Key
+	Secret string `json:"key"`
+}
+
+// CreateKey handles requests creating api keys. The secret is only returned
+// in the response.
+func (js *JServer) CreateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	var req keyRequest
+	data, ok := ctx.readBody()
+	if !ok || !ctx.unmarshalJSON(data, &req) {
+		return
+	}
+	k := &key.Key{Name: req.Name, Scopes: req.Scopes, Docs: req.Docs, Expires: req.Expires}
+	secret, err := js.keys.Create(k)
+	if err == key.ErrKeyExists {
+		ctx.text(http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Cause(err) == key.ErrInvalidKey {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		js.logger.Error("failed to create key", zap.String("cmd", "create-key"), zap.String("name", req.Name), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write keys")
+		return
+	}
+	js.logger.Info("create key", zap.String("name", req.Name))
+	res := keyResult{Key: *k, Secret: secret}
+	res.Hash = ""
+	ctx.json(http.StatusCreated, res)
+}
+
+// ListKeys handles requests listing api keys.
+func (js *JServer) ListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	ctx.json(http.StatusOK, js.keys.List())
+}
+
+// RevokeKey handles requests removing api keys.
+func (js *JServer) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	if !js.admin(ctx) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	ok, err := js.keys.Revoke(name)
+	if err != nil {
+		js.logger.Error("failed to revoke key", zap.String("cmd", "revoke-key"), zap.String("name", name), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write keys")
+		return
+	}
+	if !ok {
+		ctx.text(http.StatusNotFound, name)
+		return
+	}
+	js.logger.Info("revoke key", zap.String("name", name))
+	ctx.statusText(http.StatusOK)
+}
+
+// admin reports if the request has an admin key not restricted to
+// documents, which is required to manage server-wide resources such as keys
+// and aliases.
+func (js *JServer) admin(ctx *httpCtx) bool {
+	k := js.keys.Authenticate(ctx.apiKey())
+	return k != nil && k.Allows(key.ScopeAdmin, "")
+}
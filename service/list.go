@@ -0,0 +1,90 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/disksing/luson/config"
+	"github.com/disksing/luson/key"
+	"github.com/disksing/luson/metastore"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+type listResult struct {
+	Docs []metastore.Entry `json:"docs"`
+	Next string            `json:"next,omitempty"`
+}
+
+// List handles requests listing documents.
+func (js *JServer) List(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	k := js.keys.Authenticate(ctx.apiKey())
+	if k == nil || !k.AllowsSome(key.ScopeRead) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	opt := metastore.ListOptions{
+		SortBy: metastore.SortByCreated,
+		Access: q.Get("access"),
+		Cursor: q.Get("cursor"),
+		Limit:  defaultListLimit,
+		Filter: func(id string) bool { return k.Allows(key.ScopeRead, id) },
+	}
+	switch q.Get("sort") {
+	case "", metastore.SortByCreated:
+	case metastore.SortByModified:
+		opt.SortBy = metastore.SortByModified
+	default:
+		ctx.text(http.StatusBadRequest, "invalid sort "+q.Get("sort"))
+		return
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opt.Desc = true
+	default:
+		ctx.text(http.StatusBadRequest, "invalid order "+q.Get("order"))
+		return
+	}
+	if opt.Access != "" && !config.ValidateAccess(opt.Access) {
+		ctx.text(http.StatusBadRequest, "invalid access "+opt.Access)
+		return
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			ctx.text(http.StatusBadRequest, "invalid limit "+s)
+			return
+		}
+		opt.Limit = limit
+	}
+
+	docs, next, err := js.mstore.List(opt, js.stat)
+	if err == metastore.ErrInvalidCursor {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if next != "" {
+		u := *r.URL
+		q.Set("cursor", next)
+		u.RawQuery = q.Encode()
+		ctx.w.Header().Set("Link", "<"+u.RequestURI()+`>; rel="next"`)
+	}
+	ctx.json(http.StatusOK, listResult{Docs: docs, Next: next})
+}
+
+func (js *JServer) stat(id string) (time.Time, int64, string, error) {
+	info, err := js.jstore.Stat(id)
+	return info.LastModify, info.Size, info.Hash, err
+}
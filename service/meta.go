@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/key"
+	"github.com/disksing/luson/metastore"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// metaView is the meta data of a document exposed by the _meta endpoint.
+// ID and Created are read only. SlidingTTL is a duration like 30m, setting it
+// also sets Expires to the TTL later.
+type metaView struct {
+	ID          string            `json:"id"`
+	Access      string            `json:"access"`
+	Created     time.Time         `json:"created"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Expires     *time.Time        `json:"expires,omitempty"`
+	SlidingTTL  string            `json:"slidingTTL,omitempty"`
+}
+
+func newMetaView(m *metastore.MetaData) *metaView {
+	v := &metaView{
+		ID:          m.ID,
+		Access:      m.Access,
+		Created:     m.Created,
+		Name:        m.Name,
+		Description: m.Description,
+		Labels:      m.Labels,
+		Expires:     m.Expires,
+	}
+	if m.SlidingTTL != 0 {
+		v.SlidingTTL = m.SlidingTTL.String()
+	}
+	return v
+}
+
+// GetMeta handles requests reading the meta data of a document.
+func (js *JServer) GetMeta(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	mdata, ok := js.getMeta(ctx, id)
+	if !ok {
+		return
+	}
+	ctx.json(http.StatusOK, newMetaView(mdata))
+}
+
+// PutMeta handles requests replacing the meta data of a document.
+func (js *JServer) PutMeta(w http.ResponseWriter, r *http.Request) {
+	js.updateMeta(w, r, false)
+}
+
+// PatchMeta handles requests changing the meta data of a document with a
+// JSON merge patch.
+func (js *JServer) PatchMeta(w http.ResponseWriter, r *http.Request) {
+	js.updateMeta(w, r, true)
+}
+
+func (js *JServer) updateMeta(w http.ResponseWriter, r *http.Request, merge bool) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	data, v, ok := ctx.readJSON()
+	if !ok {
+		return
+	}
+
+	// The merge patch applies to the meta data of the moment, so it is done
+	// in the update.
+	m, err := js.mstore.Update(id, func(m *metastore.MetaData) error {
+		return applyMetaView(m, data, v, merge)
+	})
+	if err == metastore.ErrNotFound {
+		ctx.text(http.StatusNotFound, id)
+		return
+	}
+	if errors.Cause(err) == metastore.ErrInvalidMeta {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		js.logger.Error("failed to put meta", zap.String("cmd", "meta"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write meta")
+		return
+	}
+	js.logger.Info("meta", zap.String("id", id), zap.String("access", m.Access))
+	ctx.json(http.StatusOK, newMetaView(m))
+}
+
+// applyMetaView sets the meta data to a view in JSON, or to the view merged
+// with the JSON merge patch v if merge is true.
+func applyMetaView(m *metastore.MetaData, data []byte, v interface{}, merge bool) error {
+	if merge {
+		cur, err := json.Marshal(newMetaView(m))
+		if err != nil {
+			return err
+		}
+		var old interface{}
+		if err = jsonp.Unmarshal(cur, &old); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(jsonp.Merge(old, v)); err != nil {
+			return err
+		}
+	}
+	var view metaView
+	if err := jsonp.Unmarshal(data, &view); err != nil {
+		return errors.Wrap(metastore.ErrInvalidMeta, err.Error())
+	}
+
+	m.Access, m.Name, m.Description, m.Labels = view.Access, view.Name, view.Description, view.Labels
+	m.Expires, m.SlidingTTL = view.Expires, 0
+	if view.SlidingTTL != "" {
+		d, err := time.ParseDuration(view.SlidingTTL)
+		if err != nil || d <= 0 {
+			return errors.Wrap(metastore.ErrInvalidMeta, "invalid slidingTTL "+view.SlidingTTL)
+		}
+		expires := time.Now().Add(d)
+		m.Expires, m.SlidingTTL = &expires, d
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disksing/luson/jsonp"
+)
+
+// readOptions are the query parameters which shape the responses of GET
+// requests. They are applied in order: jsonpath, filter, sort, offset and
+// limit, fields.
+type readOptions struct {
+	jsonPath *jsonp.Query  // `jsonpath`, select nodes by a JSONPath query
+	paths    bool          // `paths`, return normalized paths instead of values
+	filter   *jsonp.Filter // `filter`, keep array elements passing a JSONPath filter
+	sort     []sortKey     // `sort`, order array elements by fields
+	offset   int           // `offset`, skip array elements
+	limit    int           // `limit`, the max number of array elements, 0 for all
+	fields   [][]string    // `fields`, project objects to some fields
+	columns  []string      // `columns`, the columns of CSV and JSON Lines rows
+}
+
+type sortKey struct {
+	pointer string
+	desc    bool
+}
+
+func (ctx *httpCtx) readOptions() (*readOptions, bool) {
+	q := ctx.r.URL.Query()
+	var opts readOptions
+	var err error
+	if s, ok := q["jsonpath"]; ok {
+		if opts.jsonPath, err = jsonp.ParseQuery(s[0]); err != nil {
+			ctx.text(http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+	_, opts.paths = q["paths"]
+	if s, ok := q["filter"]; ok {
+		if opts.filter, err = jsonp.ParseFilter(s[0]); err != nil {
+			ctx.text(http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+	if s := q.Get("sort"); s != "" {
+		for _, f := range strings.Split(s, ",") {
+			var k sortKey
+			if strings.HasPrefix(f, "-") {
+				k.desc = true
+				f = f[1:]
+			}
+			if f == "" {
+				ctx.text(http.StatusBadRequest, "invalid sort "+s)
+				return nil, false
+			}
+			k.pointer = fieldPointer(f)
+			opts.sort = append(opts.sort, k)
+		}
+	}
+	if s := q.Get("offset"); s != "" {
+		if opts.offset, err = strconv.Atoi(s); err != nil || opts.offset < 0 {
+			ctx.text(http.StatusBadRequest, "invalid offset "+s)
+			return nil, false
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if opts.limit, err = strconv.Atoi(s); err != nil || opts.limit <= 0 || opts.limit > maxListLimit {
+			ctx.text(http.StatusBadRequest, "invalid limit "+s)
+			return nil, false
+		}
+	}
+	if s := q.Get("fields"); s != "" {
+		for _, f := range strings.Split(s, ",") {
+			if f == "" {
+				ctx.text(http.StatusBadRequest, "invalid fields "+s)
+				return nil, false
+			}
+			opts.fields = append(opts.fields, strings.Split(f, "."))
+		}
+		opts.fields = prefixFields(opts.fields)
+	}
+	if s := q.Get("columns"); s != "" {
+		opts.columns = strings.Split(s, ",")
+	}
+	return &opts, true
+}
+
+// fieldPointer converts a dotted field to a JSON pointer.
+func fieldPointer(f string) string {
+	var sb strings.Builder
+	for _, s := range strings.Split(f, ".") {
+		sb.WriteString("/" + jsonp.PointerEscaper.Replace(s))
+	}
+	return sb.String()
+}
+
+// prefixFields removes the fields which are inside other fields, e.g. `a.b`
+// with `a`.
+func prefixFields(fields [][]string) [][]string {
+	var res [][]string
+	for i, f := range fields {
+		inside := false
+		for j, g := range fields {
+			if j != i && len(g) <= len(f) && hasPrefix(f, g) && (len(g) < len(f) || j < i) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func hasPrefix(f, prefix []string) bool {
+	for i := range prefix {
+		if f[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (opts *readOptions) hasArrayOptions() bool {
+	return opts.filter != nil || len(opts.sort) > 0 || opts.offset > 0 || opts.limit > 0
+}
+
+// reply shapes the node addressed by the request URL, and replies it in
+// the format of Accept.
+func (opts *readOptions) reply(ctx *httpCtx, v interface{}) {
+	v, ok := opts.apply(ctx, v)
+	if !ok {
+		return
+	}
+	if f := ctx.acceptRows(); f != "" {
+		ctx.writeRows(f, v, opts.columns)
+		return
+	}
+	ctx.json(http.StatusOK, v)
+}
+
+// apply shapes the node addressed by the request URL. Array options set the
+// `X-Total-Count` header to the number of elements passing the filter, and
+// `Link` to the other pages if there is a limit. Values are not copied, except
+// projected objects.
+func (opts *readOptions) apply(ctx *httpCtx, v interface{}) (interface{}, bool) {
+	root := v
+	if opts.jsonPath != nil {
+		nodes := opts.jsonPath.Select(v)
+		res := make(jsonp.Array, 0, len(nodes))
+		for _, n := range nodes {
+			if opts.paths {
+				res = append(res, n.Path())
+			} else {
+				res = append(res, n.Value)
+			}
+		}
+		v = res
+	}
+
+	if opts.hasArrayOptions() {
+		arr, ok := v.(jsonp.Array)
+		if !ok {
+			ctx.text(http.StatusBadRequest, "node is not array")
+			return nil, false
+		}
+		if opts.filter != nil {
+			res := make(jsonp.Array, 0)
+			for _, x := range arr {
+				if opts.filter.Match(root, x) {
+					res = append(res, x)
+				}
+			}
+			arr = res
+		}
+		if len(opts.sort) > 0 {
+			if opts.filter == nil {
+				arr = append(make(jsonp.Array, 0, len(arr)), arr...)
+			}
+			opts.sortArray(arr)
+		}
+		total := len(arr)
+		ctx.w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		start, end := opts.offset, total
+		if start > total {
+			start = total
+		}
+		if opts.limit > 0 {
+			if opts.limit < end-start {
+				end = start + opts.limit
+			}
+			ctx.w.Header().Set("Link", ctx.pageLinks(opts.offset, opts.limit, total))
+		}
+		v = arr[start:end]
+	}
+
+	if opts.fields != nil {
+		switch x := v.(type) {
+		case jsonp.Object:
+			v = project(x, opts.fields)
+		case jsonp.Array:
+			res := make(jsonp.Array, 0, len(x))
+			for _, e := range x {
+				if obj, ok := e.(jsonp.Object); ok {
+					res = append(res, project(obj, opts.fields))
+				} else {
+					res = append(res, e)
+				}
+			}
+			v = res
+		default:
+			ctx.text(http.StatusBadRequest, "node is not object or array")
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func (opts *readOptions) sortArray(arr jsonp.Array) {
+	sort.SliceStable(arr, func(i, j int) bool {
+		for _, k := range opts.sort {
+			a, _ := jsonp.Get(arr[i], k.pointer)
+			b, _ := jsonp.Get(arr[j], k.pointer)
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != k.desc
+		}
+		return false
+	})
+}
+
+// sortRank orders values of different types: missing or null, booleans,
+// numbers, strings, then arrays and objects.
+func sortRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	case jsonp.Array, jsonp.Object:
+		return 4
+	}
+	return 2
+}
+
+func compareValues(a, b interface{}) int {
+	ra, rb := sortRank(a), sortRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch x := a.(type) {
+	case bool:
+		if x == b.(bool) {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	if x, ok := jsonp.Number(a); ok {
+		if y, ok := jsonp.Number(b); ok {
+			return x.Cmp(y)
+		}
+	}
+	return 0
+}
+
+// project copies some fields of an object. Fields must not be inside other
+// fields, so that the values of the object are never modified.
+func project(obj jsonp.Object, fields [][]string) jsonp.Object {
+	res := make(jsonp.Object)
+	for _, f := range fields {
+		projectField(res, obj, f)
+	}
+	return res
+}
+
+func projectField(dst, src jsonp.Object, f []string) {
+	v, ok := src[f[0]]
+	if !ok {
+		return
+	}
+	if len(f) == 1 {
+		dst[f[0]] = v
+		return
+	}
+	sub, ok := v.(jsonp.Object)
+	if !ok {
+		return
+	}
+	d, ok := dst[f[0]].(jsonp.Object)
+	if !ok {
+		d = make(jsonp.Object)
+		dst[f[0]] = d
+	}
+	projectField(d, sub, f[1:])
+}
+
+// pageLinks returns the Link header (RFC 8288) to the first, previous, next
+// and last pages.
+func (ctx *httpCtx) pageLinks(offset, limit, total int) string {
+	link := func(offset int, rel string) string {
+		q := ctx.r.URL.Query()
+		q.Set("offset", strconv.Itoa(offset))
+		q.Set("limit", strconv.Itoa(limit))
+		return "<" + ctx.r.URL.EscapedPath() + "?" + q.Encode() + `>; rel="` + rel + `"`
+	}
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	links := []string{link(0, "first")}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if limit < total-offset {
+		links = append(links, link(offset+limit, "next"))
+	}
+	links = append(links, link(last, "last"))
+	return strings.Join(links, ", ")
+}
@@ -11,12 +11,35 @@ import (
 func NewRouter(js *JServer) *mux.Router {
 	r := mux.NewRouter().UseEncodedPath()
 
-	id := fmt.Sprintf("{id:%s}", util.UUIDRegexp)
+	id := fmt.Sprintf("{id:%s}", util.IDRegexp)
 
 	r.HandleFunc("/", js.Create).Methods("POST")
+	r.HandleFunc("/_docs", js.List).Methods("GET")
+	r.HandleFunc("/_ws", js.WebSocket).Methods("GET")
+	r.HandleFunc("/_batch", js.Batch).Methods("POST")
+	r.HandleFunc("/_keys", js.CreateKey).Methods("POST")
+	r.HandleFunc("/_keys", js.ListKeys).Methods("GET")
+	r.HandleFunc("/_keys/{name}", js.RevokeKey).Methods("DELETE")
+	r.HandleFunc("/_aliases", js.ListAliases).Methods("GET")
+	r.HandleFunc("/_aliases/{name}", js.GetAlias).Methods("GET")
+	r.HandleFunc("/_aliases/{name}", js.PutAlias).Methods("PUT")
+	r.HandleFunc("/_aliases/{name}", js.DeleteAlias).Methods("DELETE")
+	r.PathPrefix("/@").Handler(js.aliasHandler(r))
+	r.HandleFunc("/"+id+"/_history", js.History).Methods("GET")
+	r.HandleFunc("/"+id+"/_revert", js.Revert).Methods("POST")
+	r.HandleFunc("/"+id+"/_schema", js.GetSchema).Methods("GET")
+	r.HandleFunc("/"+id+"/_schema", js.PutSchema).Methods("PUT")
+	r.HandleFunc("/"+id+"/_schema", js.DeleteSchema).Methods("DELETE")
+	r.HandleFunc("/"+id+"/_meta", js.GetMeta).Methods("GET")
+	r.HandleFunc("/"+id+"/_meta", js.PutMeta).Methods("PUT")
+	r.HandleFunc("/"+id+"/_meta", js.PatchMeta).Methods("PATCH")
+	r.HandleFunc("/"+id+"/_share", js.Share).Methods("POST")
+	r.HandleFunc("/"+id+"/_share", js.Unshare).Methods("DELETE")
 	r.PathPrefix("/" + id).HandlerFunc(js.Get).Methods("GET")
 	r.PathPrefix("/" + id).HandlerFunc(js.Put).Methods("PUT")
+	r.PathPrefix("/" + id).HandlerFunc(js.Append).Methods("POST")
 	r.PathPrefix("/" + id).HandlerFunc(js.Patch).Methods("PATCH")
+	r.PathPrefix("/" + id).HandlerFunc(js.Delete).Methods("DELETE")
 
 	return r
 }
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disksing/luson/codec"
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/jsonstore"
+	"github.com/pkg/errors"
+)
+
+// Arrays can be exported and imported as rows, in CSV with nested objects in
+// dotted columns, or in JSON Lines with a value per line.
+const (
+	csvFormat    = "csv"
+	ndjsonFormat = "ndjson"
+)
+
+var rowFormats = map[string]string{
+	"text/csv":             csvFormat,
+	"application/x-ndjson": ndjsonFormat,
+	"application/jsonl":    ndjsonFormat,
+}
+
+// requestRows returns the row format of the request body, if any.
+func (ctx *httpCtx) requestRows() string {
+	return rowFormats[mediaType(ctx.r.Header.Get("Content-Type"))]
+}
+
+// acceptRows returns the row format of the response, if it is preferred by
+// Accept to the other formats.
+func (ctx *httpCtx) acceptRows() string {
+	for _, a := range ctx.accepts() {
+		if f, ok := rowFormats[a.typ]; ok {
+			return f
+		}
+		if codec.ByMediaType(a.typ) != nil || strings.HasSuffix(a.typ, "/*") {
+			return ""
+		}
+	}
+	return ""
+}
+
+// writeRows streams the elements of an array. Columns are the CSV columns, or
+// the fields of JSON Lines rows. CSV columns are inferred from the elements
+// if absent.
+func (ctx *httpCtx) writeRows(format string, v interface{}, columns []string) {
+	arr, ok := v.(jsonp.Array)
+	if !ok {
+		ctx.text(http.StatusNotAcceptable, "node is not array")
+		return
+	}
+	if format == ndjsonFormat {
+		var fields [][]string
+		for _, c := range columns {
+			fields = append(fields, strings.Split(c, "."))
+		}
+		fields = prefixFields(fields)
+		ctx.w.Header().Set("Content-Type", "application/x-ndjson")
+		ctx.w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(ctx.w)
+		for _, x := range arr {
+			if obj, ok := x.(jsonp.Object); ok && fields != nil {
+				x = project(obj, fields)
+			}
+			if enc.Encode(x) != nil {
+				return
+			}
+		}
+		return
+	}
+
+	infer := columns == nil
+	seen := make(map[string]bool)
+	for _, x := range arr {
+		obj, ok := x.(jsonp.Object)
+		if !ok {
+			ctx.text(http.StatusNotAcceptable, "element is not object")
+			return
+		}
+		if infer {
+			inferColumns("", obj, seen, &columns)
+		}
+	}
+	ctx.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	ctx.w.WriteHeader(http.StatusOK)
+	w := csv.NewWriter(ctx.w)
+	if w.Write(columns) != nil {
+		return
+	}
+	rec := make([]string, len(columns))
+	cells := make(map[string]interface{})
+	for _, x := range arr {
+		for k := range cells {
+			delete(cells, k)
+		}
+		flatten("", x.(jsonp.Object), cells)
+		for i, c := range columns {
+			rec[i] = formatCell(cells[c])
+		}
+		if w.Write(rec) != nil {
+			return
+		}
+	}
+	w.Flush()
+}
+
+// inferColumns adds the columns of an object, in key order, which are not
+// seen before.
+func inferColumns(prefix string, obj jsonp.Object, seen map[string]bool, columns *[]string) {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, ok := obj[k].(jsonp.Object); ok && len(sub) > 0 {
+			inferColumns(prefix+k+".", sub, seen, columns)
+		} else if !seen[prefix+k] {
+			seen[prefix+k] = true
+			*columns = append(*columns, prefix+k)
+		}
+	}
+}
+
+func flatten(prefix string, obj jsonp.Object, cells map[string]interface{}) {
+	for k, v := range obj {
+		if sub, ok := v.(jsonp.Object); ok && len(sub) > 0 {
+			flatten(prefix+k+".", sub, cells)
+		} else {
+			cells[prefix+k] = v
+		}
+	}
+}
+
+// formatCell formats a value in a CSV cell. Null and missing values are
+// empty, arrays and empty objects are in JSON.
+func formatCell(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case json.Number:
+		return string(x)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// decodeRows parses the rows of a request body to an array.
+func decodeRows(format string, data []byte) (jsonp.Array, error) {
+	rows := make(jsonp.Array, 0)
+	if format == ndjsonFormat {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		for {
+			var v interface{}
+			err := dec.Decode(&v)
+			if err == io.EOF {
+				return rows, nil
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid row %d", len(rows)+1)
+			}
+			rows = append(rows, v)
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err == io.EOF {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, c := range header {
+		if c == "" || seen[c] {
+			return nil, errors.Errorf("invalid column '%s'", c)
+		}
+		seen[c] = true
+	}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj := make(jsonp.Object)
+		for i, c := range header {
+			if rec[i] == "" {
+				continue
+			}
+			if err = setDotted(obj, strings.Split(c, "."), parseCell(rec[i])); err != nil {
+				return nil, errors.WithMessagef(err, "invalid row %d", len(rows)+1)
+			}
+		}
+		rows = append(rows, obj)
+	}
+}
+
+func setDotted(obj jsonp.Object, path []string, v interface{}) error {
+	for _, k := range path[:len(path)-1] {
+		sub, ok := obj[k].(jsonp.Object)
+		if !ok {
+			if _, exists := obj[k]; exists {
+				return errors.Errorf("conflicting column %s", strings.Join(path, "."))
+			}
+			sub = make(jsonp.Object)
+			obj[k] = sub
+		}
+		obj = sub
+	}
+	k := path[len(path)-1]
+	if _, exists := obj[k]; exists {
+		return errors.Errorf("conflicting column %s", strings.Join(path, "."))
+	}
+	obj[k] = v
+	return nil
+}
+
+var numberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// parseCell converts a CSV cell to a number, a boolean, JSON text of an array
+// or object, or else a string.
+func parseCell(s string) interface{} {
+	switch {
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case numberRegexp.MatchString(s):
+		return json.Number(s)
+	case s[0] == '[' || s[0] == '{':
+		var v interface{}
+		if jsonp.Unmarshal([]byte(s), &v) == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// Append handles POST requests to documents, which append the rows of a CSV
+// or JSON Lines body to the array at the pointer.
+func (js *JServer) Append(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id, p, ok := ctx.uriPointer()
+	if !ok {
+		return
+	}
+	if ctx.requestRows() == "" {
+		ctx.statusText(http.StatusUnsupportedMediaType)
+		return
+	}
+	_, v, ok := ctx.readJSON()
+	if !ok {
+		return
+	}
+
+	txn, ok := js.update(ctx, func(txn *jsonstore.Txn) bool {
+		return js.appendTxn(ctx, txn, id, p, v.(jsonp.Array))
+	})
+	if !ok {
+		return
+	}
+	js.setResult(ctx, txn, id)
+	ctx.statusText(http.StatusOK)
+}
+
+// appendTxn appends rows to the array at the pointer in the transaction.
+func (js *JServer) appendTxn(ctx *httpCtx, txn *jsonstore.Txn, id, p string, rows jsonp.Array) bool {
+	if !js.checkMetaForWrite(ctx, id, p) || !js.withPreconditions(ctx, txn, id) {
+		return false
+	}
+	doc, ok := js.txnGetForWrite(ctx, txn, id, p)
+	if !ok {
+		return false
+	}
+	target, err := doc.Get(p)
+	if err != nil {
+		ctx.text(http.StatusNotAcceptable, err.Error())
+		return false
+	}
+	arr, ok := target.(jsonp.Array)
+	if !ok {
+		ctx.text(http.StatusNotAcceptable, "node is not array")
+		return false
+	}
+	// The array is shared with readers, appending must not reuse its spare
+	// capacity.
+	if doc, err = doc.Replace(p, append(arr[:len(arr):len(arr)], rows...)); err != nil {
+		ctx.text(http.StatusNotAcceptable, err.Error())
+		return false
+	}
+	txn.Put(id, doc.Value())
+	return true
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/disksing/luson/jsonstore"
+	"github.com/disksing/luson/key"
+	"github.com/disksing/luson/metastore"
+	"github.com/disksing/luson/schema"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// schemaError is a validation failure of a document written by a request.
+type schemaError struct {
+	ID string `json:"id"`
+	schema.Error
+}
+
+// schemaCache keeps the compiled schemas of documents, with the meta data
+// they are compiled from. Meta data is replaced instead of modified, so a
+// schema is stale once the document has other meta data.
+type schemaCache struct {
+	sync.Mutex
+	m map[string]cachedSchema // id => schema
+}
+
+type cachedSchema struct {
+	meta   *metastore.MetaData
+	schema *schema.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{m: make(map[string]cachedSchema)}
+}
+
+// get returns the compiled schema of the meta data.
+func (c *schemaCache) get(mdata *metastore.MetaData) (*schema.Schema, error) {
+	c.Lock()
+	e, ok := c.m[mdata.ID]
+	c.Unlock()
+	if ok && e.meta == mdata {
+		return e.schema, nil
+	}
+	s, err := schema.Compile(mdata.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	c.m[mdata.ID] = cachedSchema{meta: mdata, schema: s}
+	c.Unlock()
+	return s, nil
+}
+
+func (c *schemaCache) remove(id string) {
+	c.Lock()
+	delete(c.m, id)
+	c.Unlock()
+}
+
+// GetSchema handles requests reading the schema of a document.
+func (js *JServer) GetSchema(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.checkMetaForRead(ctx, id, "") {
+		return
+	}
+	mdata, err := js.mstore.Get(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if mdata == nil {
+		ctx.text(http.StatusNotFound, id)
+		return
+	}
+	if mdata.Schema == nil {
+		ctx.text(http.StatusNotFound, "no schema")
+		return
+	}
+	ctx.json(http.StatusOK, mdata.Schema)
+}
+
+// PutSchema handles requests attaching a schema to a document. The current
+// document must be valid against the new schema.
+func (js *JServer) PutSchema(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	_, v, ok := ctx.readJSON()
+	if !ok {
+		return
+	}
+	s, err := schema.Compile(v)
+	if err != nil {
+		ctx.text(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !js.checkMetaForWrite(ctx, id, "") {
+		return
+	}
+	doc, _, err := js.jstore.Get(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errs := schemaErrors(id, s.Validate(doc)); len(errs) > 0 {
+		ctx.json(http.StatusUnprocessableEntity, map[string]interface{}{"errors": errs})
+		return
+	}
+	js.putSchema(ctx, id, v)
+}
+
+// DeleteSchema handles requests detaching the schema of a document.
+func (js *JServer) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	if !js.checkMetaForWrite(ctx, id, "") {
+		return
+	}
+	js.putSchema(ctx, id, nil)
+}
+
+func (js *JServer) putSchema(ctx *httpCtx, id string, v interface{}) {
+	_, err := js.mstore.Update(id, func(m *metastore.MetaData) error {
+		m.Schema = v
+		return nil
+	})
+	js.schemas.remove(id)
+	if err == metastore.ErrNotFound {
+		ctx.text(http.StatusNotFound, id)
+		return
+	}
+	if err != nil {
+		js.logger.Error("failed to put meta", zap.String("cmd", "schema"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write meta")
+		return
+	}
+	ctx.statusText(http.StatusOK)
+}
+
+// validate checks the documents written by txn against their schemas, or
+// responds with the failures.
+func (js *JServer) validate(ctx *httpCtx, txn *jsonstore.Txn) bool {
+	writes := txn.Writes()
+	ids := make([]string, 0, len(writes))
+	for id := range writes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var res []schemaError
+	for _, id := range ids {
+		mdata, err := js.mstore.Get(id)
+		if err != nil {
+			ctx.text(http.StatusInternalServerError, err.Error())
+			return false
+		}
+		if mdata == nil || mdata.Schema == nil {
+			continue
+		}
+		s, err := js.schemas.get(mdata)
+		if err != nil {
+			ctx.text(http.StatusInternalServerError, err.Error())
+			return false
+		}
+		res = append(res, schemaErrors(id, s.Validate(writes[id]))...)
+	}
+	if len(res) > 0 {
+		ctx.json(http.StatusUnprocessableEntity, map[string]interface{}{"errors": res})
+		return false
+	}
+	return true
+}
+
+func schemaErrors(id string, errs []schema.Error) []schemaError {
+	res := make([]schemaError, 0, len(errs))
+	for _, e := range errs {
+		res = append(res, schemaError{ID: id, Error: e})
+	}
+	return res
+}
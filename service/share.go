@@ -0,0 +1,153 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/disksing/luson/key"
+	"github.com/disksing/luson/metastore"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type shareRequest struct {
+	Path    string    `json:"path"`
+	Methods []string  `json:"methods"`
+	Expires time.Time `json:"expires"`
+	TTL     int64     `json:"ttl"` // seconds, if expires is not set
+}
+
+type shareResult struct {
+	Token   string    `json:"token"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// Share handles requests minting share tokens of a document.
+func (js *JServer) Share(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	var req shareRequest
+	data, ok := ctx.readBody()
+	if !ok || !ctx.unmarshalJSON(data, &req) {
+		return
+	}
+	if req.Path != "" && req.Path[0] != '/' {
+		ctx.text(http.StatusBadRequest, "invalid path "+req.Path)
+		return
+	}
+	if len(req.Methods) == 0 {
+		req.Methods = []string{http.MethodGet}
+	}
+	for _, m := range req.Methods {
+		switch m {
+		case http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			ctx.text(http.StatusBadRequest, "invalid method "+m)
+			return
+		}
+	}
+	if req.Expires.IsZero() {
+		if req.TTL <= 0 {
+			ctx.text(http.StatusBadRequest, "expect expires or ttl")
+			return
+		}
+		req.Expires = time.Now().Add(time.Duration(req.TTL) * time.Second)
+	}
+	if !req.Expires.After(time.Now()) {
+		ctx.text(http.StatusBadRequest, "token expires in the past")
+		return
+	}
+
+	mdata, ok := js.getMeta(ctx, id)
+	if !ok {
+		return
+	}
+	t := &key.ShareToken{
+		ID:         id,
+		Pointer:    req.Path,
+		Methods:    req.Methods,
+		Expires:    req.Expires.Unix(),
+		Generation: mdata.ShareGeneration,
+	}
+	token, err := js.signer.Sign(t)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.json(http.StatusCreated, &shareResult{
+		Token:   token,
+		URL:     docURL(id, req.Path) + "?token=" + url.QueryEscape(token),
+		Expires: time.Unix(t.Expires, 0).UTC(),
+	})
+}
+
+// Unshare handles requests revoking all share tokens of a document.
+func (js *JServer) Unshare(w http.ResponseWriter, r *http.Request) {
+	ctx := newCtx(w, r)
+	id := mux.Vars(r)["id"]
+	if !js.authorized(ctx, key.ScopeAdmin, id) {
+		ctx.statusText(http.StatusUnauthorized)
+		return
+	}
+	_, err := js.mstore.Update(id, func(m *metastore.MetaData) error {
+		m.ShareGeneration++
+		return nil
+	})
+	if err == metastore.ErrNotFound {
+		ctx.text(http.StatusNotFound, id)
+		return
+	}
+	if err != nil {
+		js.logger.Error("failed to put meta", zap.String("cmd", "unshare"), zap.String("id", id), zap.Error(err))
+		ctx.text(http.StatusInternalServerError, "failed to write meta")
+		return
+	}
+	ctx.statusText(http.StatusOK)
+}
+
+// shared reports if the share token of the request grants access to the node
+// of a document.
+func (js *JServer) shared(ctx *httpCtx, mdata *metastore.MetaData, p string) bool {
+	token := ctx.shareToken()
+	if token == "" {
+		return false
+	}
+	t, err := js.signer.Verify(token)
+	if err != nil {
+		return false
+	}
+	return t.Generation == mdata.ShareGeneration && t.Allows(mdata.ID, p, ctx.r.Method)
+}
+
+func (js *JServer) getMeta(ctx *httpCtx, id string) (*metastore.MetaData, bool) {
+	mdata, err := js.mstore.Get(id)
+	if err != nil {
+		ctx.text(http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if mdata == nil {
+		ctx.text(http.StatusNotFound, id)
+		return nil, false
+	}
+	return mdata, true
+}
+
+// docURL returns the URL path of the node of a document.
+func docURL(id, pointer string) string {
+	var sb strings.Builder
+	sb.WriteString("/" + id)
+	if pointer != "" {
+		for _, s := range strings.Split(pointer[1:], "/") {
+			sb.WriteString("/" + url.PathEscape(jsonp.PointerUnescaper.Replace(s)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/disksing/luson/jsonp"
+	"github.com/gorilla/websocket"
+)
+
+// The WebSocket protocol exchanges JSON messages. Requests from the client
+// carry a `seq` number which is echoed by the `ack` or `error` reply.
+//
+// Client messages:
+//
+//	{"type": "subscribe", "seq": 1, "id": "<uuid>", "path": "/pointer", "diff": false}
+//	{"type": "unsubscribe", "seq": 2, "id": "<uuid>", "path": "/pointer"}
+//	{"type": "patch", "seq": 3, "id": "<uuid>", "path": "/base", "ops": [...], "ifMatch": "<etag>"}
+//
+// Server messages:
+//
+//	{"type": "ack", "seq": 1}
+//	{"type": "ack", "seq": 3, "etag": "<new hash>"}
+//	{"type": "error", "seq": 3, "status": 412, "message": "Precondition Failed"}
+//	{"type": "snapshot", "id": "<uuid>", "path": "/pointer", "etag": "<hash>", "value": ...}
+//	{"type": "patch", "id": "<uuid>", "path": "/pointer", "etag": "<hash>", "ops": [...]}
+//
+// A subscription starts with a snapshot of the value under the pointer, and
+// is followed by a snapshot for each change, or a patch against the last
+// message if `diff` is set. Patch requests are applied as JSON Patch
+// (RFC6902) with the same access checks as HTTP PATCH requests, using the
+// credentials of the WebSocket handshake.
+type wsMessage struct {
+	Type    string          `json:"type"`
+	Seq     int64           `json:"seq,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Diff    bool            `json:"diff,omitempty"`
+	Ops     json.RawMessage `json:"ops,omitempty"`
+	IfMatch string          `json:"ifMatch,omitempty"`
+	ETag    string          `json:"etag,omitempty"`
+	Status  int             `json:"status,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// wsSnapshot is a snapshot message. Value is always present, even if null.
+type wsSnapshot struct {
+	Type  string      `json:"type"`
+	ID    string      `json:"id"`
+	Path  string      `json:"path"`
+	ETag  string      `json:"etag"`
+	Value interface{} `json:"value"`
+}
+
+// wsSub is the key of a subscription, the id as the client sent it.
+type wsSub struct {
+	id, path string
+}
+
+type wsConn struct {
+	js *JServer
+	r  *http.Request
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+
+	sync.Mutex
+	subs map[wsSub]chan struct{} // => stop
+}
+
+// WebSocket handles WebSocket connections.
+func (js *JServer) WebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: js.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has replied with the error.
+		return
+	}
+	c := &wsConn{js: js, r: r, conn: conn, subs: make(map[wsSub]chan struct{})}
+	defer c.close()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m wsMessage
+		if err = json.Unmarshal(data, &m); err != nil {
+			c.fail(0, http.StatusBadRequest, err.Error())
+			continue
+		}
+		switch m.Type {
+		case "subscribe":
+			c.subscribe(&m)
+		case "unsubscribe":
+			c.unsubscribe(&m)
+		case "patch":
+			c.patch(&m)
+		default:
+			c.fail(m.Seq, http.StatusBadRequest, "invalid message type "+m.Type)
+		}
+	}
+}
+
+// checkOrigin allows handshakes without Origin, which do not come from
+// browsers, and from pages of the server itself or of WSOrigins. Other sites
+// must not use the cookies or other credentials of the browser.
+func (js *JServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range js.conf.WSOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func (c *wsConn) send(v interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.WriteJSON(v)
+}
+
+func (c *wsConn) ack(seq int64, etag string) {
+	c.send(&wsMessage{Type: "ack", Seq: seq, ETag: etag})
+}
+
+func (c *wsConn) fail(seq int64, status int, message string) {
+	c.send(&wsMessage{Type: "error", Seq: seq, Status: status, Message: message})
+}
+
+func (c *wsConn) close() {
+	c.Lock()
+	for k, stop := range c.subs {
+		close(stop)
+		delete(c.subs, k)
+	}
+	c.Unlock()
+	c.conn.Close()
+}
+
+// innerCtx makes a context to run handler logic for a message, with the
+// credentials of the handshake request.
+func (c *wsConn) innerCtx(method string, header http.Header) (*httpCtx, *recorder) {
+	r := c.r.Clone(c.r.Context())
+	r.Method = method
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	rec := newRecorder()
+	return newCtx(rec, r), rec
+}
+
+// resolve returns the UUID of the document of a message, which may refer to
+// it by alias.
+func (c *wsConn) resolve(m *wsMessage) (string, bool) {
+	id, ok := c.js.resolveID(m.ID)
+	if ok {
+		return id, true
+	}
+	if strings.HasPrefix(m.ID, "@") {
+		c.fail(m.Seq, http.StatusNotFound, "alias not found")
+	} else {
+		c.fail(m.Seq, http.StatusBadRequest, "expected UUID in id")
+	}
+	return "", false
+}
+
+func (c *wsConn) subscribe(m *wsMessage) {
+	if err := jsonp.ValidPointer(m.Path); err != nil {
+		c.fail(m.Seq, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, ok := c.resolve(m)
+	if !ok {
+		return
+	}
+	ctx, rec := c.innerCtx("GET", nil)
+	if !c.js.checkMetaForRead(ctx, id, m.Path) {
+		c.fail(m.Seq, rec.status, rec.body.String())
+		return
+	}
+
+	key := wsSub{id: m.ID, path: m.Path}
+	stop := make(chan struct{})
+	c.Lock()
+	if _, ok := c.subs[key]; ok {
+		c.Unlock()
+		c.fail(m.Seq, http.StatusConflict, "already subscribed")
+		return
+	}
+	c.subs[key] = stop
+	c.Unlock()
+
+	// Subscribe before reading the current value, so no change is missed.
+	sub := c.js.feed.subscribe(id)
+	v, info, err := c.js.jstore.Get(id)
+	if err != nil {
+		c.js.feed.unsubscribe(id, sub)
+		c.Lock()
+		delete(c.subs, key)
+		c.Unlock()
+		c.fail(m.Seq, http.StatusInternalServerError, err.Error())
+		return
+	}
+	last, _ := jsonp.Get(v, m.Path)
+	c.ack(m.Seq, "")
+	c.send(&wsSnapshot{Type: "snapshot", ID: m.ID, Path: m.Path, ETag: info.Hash, Value: last})
+
+	go func(id string, key wsSub, diff bool) {
+		name, p := key.id, key.path
+		defer c.js.feed.unsubscribe(id, sub)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sub.notify:
+				ch := sub.pop()
+				if ch == nil {
+					continue
+				}
+				if ch.deleted {
+					c.Lock()
+					delete(c.subs, key)
+					c.Unlock()
+					c.send(&wsMessage{Type: "error", ID: name, Path: p, Status: http.StatusNotFound, Message: "document deleted"})
+					return
+				}
+				cur, _ := jsonp.Get(ch.value, p)
+				if reflect.DeepEqual(cur, last) {
+					continue
+				}
+				if diff {
+					ops, _ := json.Marshal(jsonp.Diff(last, cur))
+					c.send(&wsMessage{Type: "patch", ID: name, Path: p, ETag: ch.info.Hash, Ops: ops})
+				} else {
+					c.send(&wsSnapshot{Type: "snapshot", ID: name, Path: p, ETag: ch.info.Hash, Value: cur})
+				}
+				last = cur
+			}
+		}
+	}(id, key, m.Diff)
+}
+
+func (c *wsConn) unsubscribe(m *wsMessage) {
+	c.Lock()
+	key := wsSub{id: m.ID, path: m.Path}
+	stop, ok := c.subs[key]
+	delete(c.subs, key)
+	c.Unlock()
+	if !ok {
+		c.fail(m.Seq, http.StatusNotFound, "not subscribed")
+		return
+	}
+	close(stop)
+	c.ack(m.Seq, "")
+}
+
+func (c *wsConn) patch(m *wsMessage) {
+	id, ok := c.resolve(m)
+	if !ok {
+		return
+	}
+	header := make(http.Header)
+	if m.IfMatch != "" {
+		header.Set("If-Match", m.IfMatch)
+	}
+	ctx, rec := c.innerCtx("PATCH", header)
+	c.js.jsonPatch(ctx, id, m.Path, m.Ops)
+	if rec.status != http.StatusOK {
+		c.fail(m.Seq, rec.status, rec.body.String())
+		return
+	}
+	c.ack(m.Seq, strings.Trim(rec.Header().Get("ETag"), `"`))
+}
+
+// recorder is a http.ResponseWriter which keeps the response, to run handler
+// logic outside of HTTP requests.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlias(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id1 := mustPostExample(r, env)
+	id2 := mustPostExample(r, env)
+	res, err := env.at("/" + id2 + "/app").withAuth().withContent("luson2").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/_aliases/prod-flags").withRawContent(`{"id":"` + id1 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/_aliases/Prod").withAuth().withRawContent(`{"id":"` + id1 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+	res, err = env.at("/_aliases/prod-flags").withAuth().withRawContent(`{"id":"11112222-3333-4444-aaaa-bbbbccccdddd"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+
+	res, err = env.at("/_aliases/prod-flags").withAuth().withRawContent(`{"id":"` + id1 + `","expect":""}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/@prod-flags/app").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("luson", res.Value)
+	res, err = env.at("/@prod-flags/_history").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/@nothing/app").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/@prod-flags/app").withAuth().withContent("flags").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id1 + "/app").get()
+	r.Nil(err)
+	r.Equal("flags", res.Value)
+
+	// Cross document paths.
+	res, err = env.at("/" + id2).withAuth().withRawContent(`[{"op":"copy","from":"@prod-flags/app","path":"/copied"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id2 + "/copied").get()
+	r.Nil(err)
+	r.Equal("flags", res.Value)
+
+	// Re-point atomically.
+	res, err = env.at("/_aliases/prod-flags").withAuth().withRawContent(`{"id":"` + id2 + `","expect":"` + id2 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+	res, err = env.at("/_aliases/prod-flags").withAuth().withRawContent(`{"id":"` + id2 + `","expect":"` + id1 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/@prod-flags/app").get()
+	r.Nil(err)
+	r.Equal("luson2", res.Value)
+
+	res, err = env.at("/_aliases").withAuth().get()
+	r.Nil(err)
+	r.Equal([]interface{}{map[string]interface{}{"name": "prod-flags", "id": id2}}, res.Value)
+
+	// Aliases of deleted documents are removed.
+	res, err = env.at("/_aliases/staging").withAuth().withRawContent(`{"id":"` + id1 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id1).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/_aliases/staging").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/_aliases/prod-flags").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/@prod-flags/app").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
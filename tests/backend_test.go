@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/disksing/luson/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackends(t *testing.T) {
+	for _, name := range []string{config.FileBackend, config.MemoryBackend, config.BoltBackend} {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			env, err := NewEnvWithBackend(name)
+			r.Nil(err)
+			defer env.Close()
+			id := mustPostExample(r, env)
+
+			res, err := env.at("/" + id + "/app").withAuth().withContent("luson2").put()
+			r.Nil(err)
+			r.Equal(http.StatusOK, res.Status)
+			r.Equal("2", res.Header.Get("X-Version"))
+			res, err = env.at("/_aliases/prod-flags").withAuth().withRawContent(`{"id":"` + id + `"}`).put()
+			r.Nil(err)
+			r.Equal(http.StatusOK, res.Status)
+			res, err = env.at("/@prod-flags/app").withParam("version", "1").get()
+			r.Nil(err)
+			r.Equal("luson", res.Value)
+
+			res, err = env.at("/_batch").withAuth().withRawContent(`{"atomic":true,"ops":[{"op":"put","id":"` + id + `","path":"/app","body":"luson3"},{"op":"get","id":"@prod-flags","path":"/app"}]}`).post()
+			r.Nil(err)
+			r.Equal(http.StatusOK, res.Status)
+			res, err = env.at("/_docs").withAuth().get()
+			r.Nil(err)
+			r.Len(res.Value.(map[string]interface{})["docs"], 1)
+
+			res, err = env.at("/" + id).withAuth().delete()
+			r.Nil(err)
+			r.Equal(http.StatusOK, res.Status)
+			res, err = env.at("/@prod-flags").get()
+			r.Nil(err)
+			r.Equal(http.StatusNotFound, res.Status)
+			res, err = env.at("/_docs").withAuth().get()
+			r.Nil(err)
+			r.Len(res.Value.(map[string]interface{})["docs"], 0)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func batchResults(r *require.Assertions, res *Res) []interface{} {
+	r.Equal(http.StatusOK, res.Status)
+	return res.Value.(map[string]interface{})["results"].([]interface{})
+}
+
+func batchStatus(v interface{}) int {
+	return int(v.(map[string]interface{})["status"].(float64))
+}
+
+func TestBatch(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id1 := mustPostExample(r, env)
+	id2 := mustPostExample(r, env)
+
+	res, err := env.at("/_batch").withAuth().withRawContent(`{"ops":[
+		{"op":"get","id":"` + id1 + `","path":"/app"},
+		{"op":"put","id":"` + id1 + `","path":"/app","body":"batch"},
+		{"op":"merge-patch","id":"` + id2 + `","body":{"app":null}},
+		{"op":"json-patch","id":"` + id2 + `","body":[{"op":"test","path":"/app","value":"x"}]},
+		{"op":"put","id":"` + id2 + `","path":"/app","body":1,"ifMatch":"nothing"},
+		{"op":"delete","id":"` + id1 + `","path":"/loveFrom"},
+		{"op":"get","id":"11112222-3333-4444-aaaa-bbbbccccdddd"}
+	]}`).post()
+	r.Nil(err)
+	results := batchResults(r, res)
+	r.Len(results, 7)
+	r.Equal(http.StatusOK, batchStatus(results[0]))
+	r.Equal("luson", results[0].(map[string]interface{})["body"])
+	r.Equal(http.StatusOK, batchStatus(results[1]))
+	r.NotEmpty(results[1].(map[string]interface{})["etag"])
+	r.Equal(http.StatusOK, batchStatus(results[2]))
+	r.NotEqual(http.StatusOK, batchStatus(results[3]))
+	r.Equal(http.StatusPreconditionFailed, batchStatus(results[4]))
+	r.Equal(http.StatusOK, batchStatus(results[5]))
+	r.Equal(http.StatusNotFound, batchStatus(results[6]))
+
+	res, err = env.at("/" + id1).get()
+	r.Nil(err)
+	r.Equal(map[string]interface{}{"app": "batch"}, res.Value)
+
+	// Access checks per operation.
+	res, err = env.at("/_batch").withRawContent(`{"ops":[
+		{"op":"get","id":"` + id1 + `"},
+		{"op":"put","id":"` + id1 + `","path":"/app","body":"x"}
+	]}`).post()
+	r.Nil(err)
+	results = batchResults(r, res)
+	r.Equal(http.StatusOK, batchStatus(results[0]))
+	r.Equal(http.StatusUnauthorized, batchStatus(results[1]))
+
+	res, err = env.at("/_batch").withRawContent(`{"ops":[{"op":"nothing","id":"` + id1 + `"}]}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
+
+func TestBatchAtomic(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id1 := mustPostExample(r, env)
+	id2 := mustPostExample(r, env)
+
+	// A failed operation rolls back the batch.
+	res, err := env.at("/_batch").withAuth().withRawContent(`{"atomic":true,"ops":[
+		{"op":"put","id":"` + id1 + `","path":"/app","body":"x"},
+		{"op":"json-patch","id":"` + id2 + `","body":[{"op":"remove","path":"/nothing"}]},
+		{"op":"delete","id":"` + id2 + `"}
+	]}`).post()
+	r.Nil(err)
+	results := batchResults(r, res)
+	r.Equal(http.StatusFailedDependency, batchStatus(results[0]))
+	r.NotEqual(http.StatusOK, batchStatus(results[1]))
+	r.NotEqual(http.StatusFailedDependency, batchStatus(results[1]))
+	r.Equal(http.StatusFailedDependency, batchStatus(results[2]))
+	res, err = env.at("/" + id1 + "/app").get()
+	r.Nil(err)
+	r.Equal("luson", res.Value)
+
+	// Operations see the writes before them.
+	res, err = env.at("/_batch").withAuth().withRawContent(`{"atomic":true,"ops":[
+		{"op":"put","id":"` + id1 + `","path":"/app","body":"x"},
+		{"op":"get","id":"` + id1 + `","path":"/app"},
+		{"op":"merge-patch","id":"` + id2 + `","body":{"app":"y"}},
+		{"op":"delete","id":"` + id2 + `"}
+	]}`).post()
+	r.Nil(err)
+	results = batchResults(r, res)
+	for _, v := range results {
+		r.Equal(http.StatusOK, batchStatus(v))
+	}
+	r.Equal("x", results[1].(map[string]interface{})["body"])
+	etag := results[0].(map[string]interface{})["etag"].(string)
+	r.NotEmpty(etag)
+	res, err = env.at("/" + id1).get()
+	r.Nil(err)
+	r.Equal(`"`+etag+`"`, res.Header.Get("ETag"))
+	res, err = env.at("/" + id2).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	// A document put after it is deleted is kept.
+	res, err = env.at("/_batch").withAuth().withRawContent(`{"atomic":true,"ops":[
+		{"op":"delete","id":"` + id1 + `"},
+		{"op":"put","id":"` + id1 + `","body":{"app":"new"}}
+	]}`).post()
+	r.Nil(err)
+	results = batchResults(r, res)
+	for _, v := range results {
+		r.Equal(http.StatusOK, batchStatus(v))
+	}
+	res, err = env.at("/" + id1 + "/app").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("new", res.Value)
+
+	// Preconditions are checked at commit.
+	res, err = env.at("/_batch").withAuth().withRawContent(`{"atomic":true,"ops":[
+		{"op":"put","id":"` + id1 + `","path":"/app","body":"z","ifMatch":"nothing"}
+	]}`).post()
+	r.Nil(err)
+	results = batchResults(r, res)
+	r.Equal(http.StatusFailedDependency, batchStatus(results[0]))
+	errRes := res.Value.(map[string]interface{})["error"]
+	r.Equal(http.StatusPreconditionFailed, batchStatus(errRes))
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/disksing/luson/codec"
+	"github.com/disksing/luson/jsonp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	var doc interface{}
+	r.Nil(jsonp.Unmarshal([]byte(`{"app":"luson","version":2,"price":8.95,"tags":["a","b"],"owner":{"name":"x","admin":true}}`), &doc))
+	for _, c := range codec.All {
+		data, err := c.Encode(doc)
+		r.Nil(err, c.Name)
+		res, err := env.at("/").withAuth().withHead("Content-Type", c.MediaTypes[0]).withRawContent(string(data)).post()
+		r.Nil(err)
+		r.Equal(http.StatusCreated, res.Status, c.Name)
+		id := res.RawContent
+
+		res, err = env.at("/" + id).get()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+		var v interface{}
+		r.Nil(jsonp.Unmarshal([]byte(res.RawContent), &v))
+		r.True(jsonp.Equal(doc, v), c.Name)
+
+		res, err = env.at("/"+id).withHead("Accept", c.MediaTypes[len(c.MediaTypes)-1]).get()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+		r.Contains(res.Header.Get("Content-Type"), c.MediaTypes[0])
+		v, err = c.Decode([]byte(res.RawContent))
+		r.Nil(err)
+		r.True(jsonp.Equal(doc, v), c.Name)
+	}
+}
+
+func TestCodecWrites(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/"+id+"/loveFrom/0").withAuth().withHead("Content-Type", "application/yaml").withRawContent("language: [Go, markdown]\n").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/yaml").withRawContent("app: null\nauthor: disksing\n").patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/x-yaml").withRawContent("- op: add\n  path: /loveFrom/-\n  value: 1\n").patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(map[string]interface{}{
+		"author":   "disksing",
+		"loveFrom": []interface{}{map[string]interface{}{"language": []interface{}{"Go", "markdown"}}, map[string]interface{}{"editor": "vscode"}, "GitHub", float64(1)},
+	}, res.Value)
+
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/toml").withRawContent("app = \"luson\"\n[owner]\nname = \"x\"\n").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id+"/owner").withHead("Accept", "application/toml").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("name = \"x\"\n", res.RawContent)
+
+	// Unsupported combinations.
+	res, err = env.at("/"+id+"/app").withHead("Accept", "application/toml").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotAcceptable, res.Status)
+	res, err = env.at("/"+id).withHead("Accept", "application/xml").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotAcceptable, res.Status)
+	res, err = env.at("/"+id).withHead("Accept", "application/xml, */*;q=0.1").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.True(res.IsJSON)
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/xml").withRawContent("<a/>").put()
+	r.Nil(err)
+	r.Equal(http.StatusUnsupportedMediaType, res.Status)
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/yaml").withRawContent("a: [").put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+	res, err = env.at("/"+id).withAuth().withHead("Content-Type", "application/yaml").withRawContent("a: 1\n---\nb: 2\n").put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	// A large document makes concurrent writers more likely to conflict.
+	filler := make([]int, 20000)
+	res, err := env.at("/").withAuth().withContent(map[string]interface{}{"items": []int{}, "keys": map[string]int{}, "filler": filler}).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	const writers, writes = 8, 5
+	var wg sync.WaitGroup
+	statuses := make(chan int, writers*writes*2)
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				res, err := env.at("/" + id).withAuth().withRawContent(fmt.Sprintf(`{"keys":{"k%d_%d":%d}}`, g, i, i)).patch()
+				if err == nil {
+					statuses <- res.Status
+				}
+				res, err = env.at("/" + id).withAuth().withRawContent(fmt.Sprintf(`[{"op":"add","path":"/items/-","value":"%d_%d"}]`, g, i)).patch()
+				if err == nil {
+					statuses <- res.Status
+				}
+			}
+		}(g)
+	}
+
+	// Readers always see a whole document, never one in the middle of a
+	// write.
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				res, err := env.at("/" + id).get()
+				if err != nil || res.Status != http.StatusOK {
+					statuses <- 0
+					return
+				}
+				doc := res.Value.(map[string]interface{})
+				if _, ok := doc["items"].([]interface{}); !ok {
+					statuses <- 0
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(statuses)
+	n := 0
+	for s := range statuses {
+		r.Equal(http.StatusOK, s)
+		n++
+	}
+	r.Equal(writers*writes*2, n)
+
+	// No update is lost.
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	doc := res.Value.(map[string]interface{})
+	r.Len(doc["items"], writers*writes)
+	r.Len(doc["keys"], writers*writes)
+}
+
+func TestConcurrentMetaUpdates(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	const writers, writes = 8, 8
+	var wg sync.WaitGroup
+	statuses := make(chan int, writers*writes)
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				res, err := env.at("/" + id + "/_meta").withAuth().withRawContent(fmt.Sprintf(`{"labels":{"k%d-%d":"v"}}`, g, i)).patch()
+				if err == nil {
+					statuses <- res.Status
+				}
+			}
+		}(g)
+	}
+	res, err := env.at("/" + id + "/_schema").withAuth().withRawContent(`{"type": "object"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	wg.Wait()
+	close(statuses)
+	for s := range statuses {
+		r.Equal(http.StatusOK, s)
+	}
+
+	// Each update applies to the result of the others.
+	res, err = env.at("/" + id + "/_schema").get()
+	r.Nil(err)
+	r.Equal(map[string]interface{}{"type": "object"}, res.Value)
+	res, err = env.at("/" + id + "/_meta").withAuth().get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["labels"], writers*writes)
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"io/ioutil"
 	"net/http"
 	"testing"
 
@@ -79,3 +80,107 @@ func TestCreatePrivate(t *testing.T) {
 	r.Equal(http.StatusOK, res.Status)
 	r.Nil(res.Value)
 }
+
+func TestPutCreate(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := "3f0bd1b6-32a5-4bb3-8e2c-9c2a1a5a0d3e"
+
+	// Without the right to create, a missing id looks like a private
+	// document.
+	res, err := env.at("/" + id).withRawContent(`{"app":"luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/"+id).withHead("If-Match", "*").withRawContent(`{"app":"luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	env.Conf.DefaultAccess = config.Private
+	private := mustPostExample(r, env)
+	env.Conf.DefaultAccess = config.Protected
+	res, err = env.at("/" + private).withRawContent(`{"app":"luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/" + id + "/app").withAuth().withRawContent(`"luson"`).put()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-Match", "*").withRawContent(`{"app":"luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-None-Match", "*").withRawContent(`{"app":"luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	r.Equal(id, res.RawContent)
+	r.NotEmpty(res.Header.Get("ETag"))
+
+	// Idempotent provisioning does not clobber.
+	res, err = env.at("/"+id).withAuth().withHead("If-None-Match", "*").withRawContent(`{"app":"other"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/" + id + "/app").get()
+	r.Nil(err)
+	r.Equal("luson", res.Value)
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"app":"other"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+}
+
+func TestPutCreateCustomID(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	res, err := env.at("/prod-flags").withAuth().withRawContent(`{"beta":true}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+
+	env.Conf.IDPattern, err = config.CompileIDPattern(`[a-z][a-z0-9.-]*`)
+	r.Nil(err)
+	for _, id := range []string{"Prod", ".x", "_docs", "a%2Fb"} {
+		res, err = env.at("/" + id).withAuth().withRawContent(`{}`).put()
+		r.Nil(err)
+		r.NotEqual(http.StatusCreated, res.Status, id)
+	}
+
+	res, err = env.at("/prod-flags").withAuth().withRawContent(`{"beta":true}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	res, err = env.at("/prod.flags").withAuth().withRawContent(`{"beta":false}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+
+	res, err = env.at("/prod-flags/beta").get()
+	r.Nil(err)
+	r.Equal(true, res.Value)
+	res, err = env.at("/prod-flags").withAuth().withRawContent(`[{"op":"copy","from":"prod.flags/beta","path":"/alpha"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/prod-flags/alpha").get()
+	r.Nil(err)
+	r.Equal(false, res.Value)
+
+	// The ids are kept in encoded dir names.
+	fs, err := ioutil.ReadDir(env.dataDir)
+	r.Nil(err)
+	for _, f := range fs {
+		r.NotContains(f.Name(), "prod")
+	}
+
+	res, err = env.at("/_docs").withAuth().get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["docs"], 2)
+
+	res, err = env.at("/prod-flags").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/prod-flags").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelete(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id).delete()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-Match", `"0123456789abcdef"`).delete()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+	res, err = env.at("/" + id + "/_meta").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	_, err = os.Stat(filepath.Join(env.dataDir, id))
+	r.True(os.IsNotExist(err))
+
+	res, err = env.at("/" + id).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
+
+func TestDeleteConcurrentReads(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	for i := 0; i < 20; i++ {
+		id := mustPostExample(r, env)
+		var wg sync.WaitGroup
+		statuses := make(chan string, 1000)
+		done := make(chan struct{})
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					res, err := env.at("/" + id).get()
+					if err != nil {
+						statuses <- err.Error()
+						return
+					}
+					if res.Status == http.StatusNotFound {
+						return
+					}
+					if res.Status != http.StatusOK || res.RawContent == "null" {
+						statuses <- res.RawContent
+						return
+					}
+					select {
+					case <-done:
+						return
+					default:
+					}
+				}
+			}()
+		}
+		res, err := env.at("/" + id).withAuth().delete()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+		close(done)
+		wg.Wait()
+		close(statuses)
+		// Readers see the whole document or nothing, never the meta data
+		// without the data.
+		for s := range statuses {
+			r.Fail("unexpected read", s)
+		}
+	}
+}
+
+func TestDeletePointer(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id + "/loveFrom/1").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/loveFrom").get()
+	r.Nil(err)
+	r.Equal(`[{"language":"Go"},"GitHub"]`, res.RawContent)
+
+	res, err = env.at("/" + id + "/author").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/" + id + "/loveFrom/5").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	etag := res.Header.Get("ETag")
+
+	res, err = env.at("/"+id+"/app").withAuth().withHead("If-Match", `"0123456789abcdef"`).delete()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id+"/app").withAuth().withHead("If-Match", etag).delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(`{"loveFrom":[{"language":"Go"},"GitHub"]}`, res.RawContent)
+}
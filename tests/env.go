@@ -5,7 +5,9 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/disksing/luson/backend"
 	"github.com/disksing/luson/config"
 	"github.com/disksing/luson/jsonstore"
 	"github.com/disksing/luson/key"
@@ -20,26 +22,45 @@ import (
 type Env struct {
 	Conf    *config.Config
 	dataDir string
+	backend backend.Backend
+	js      *service.JServer
 	server  *http.Server
 	addr    string
 }
 
 // NewEnv creates env for tests.
 func NewEnv() (*Env, error) {
+	return NewEnvWithBackend(config.FileBackend)
+}
+
+// NewEnvWithBackend creates env for tests which stores documents in the
+// backend.
+func NewEnvWithBackend(name string) (*Env, error) {
 	c := dig.New()
-	_ = c.Provide(newMockConfig)
+	_ = c.Provide(func() (*config.Config, error) {
+		conf, err := newMockConfig()
+		if err == nil {
+			conf.Backend = name
+		}
+		return conf, err
+	})
 	_ = c.Provide(util.NewLogger)
 	_ = c.Provide(config.NewDataDir)
 	_ = c.Provide(newMockAPIKey)
+	_ = c.Provide(key.NewRegistry)
+	_ = c.Provide(key.NewSigner)
+	_ = c.Provide(backend.New)
 	_ = c.Provide(metastore.NewStore)
 	_ = c.Provide(jsonstore.NewStore)
 	_ = c.Provide(service.NewJServer)
 	_ = c.Provide(service.NewRouter)
 
 	env := &Env{}
-	err := c.Invoke(func(conf *config.Config, router *mux.Router) error {
+	err := c.Invoke(func(conf *config.Config, b backend.Backend, js *service.JServer, router *mux.Router) error {
 		env.Conf = conf
 		env.dataDir = conf.DataDir
+		env.backend = b
+		env.js = js
 		lis, err := net.Listen("tcp", "127.0.0.1:0")
 		if err != nil {
 			return err
@@ -61,6 +82,8 @@ func NewEnv() (*Env, error) {
 // Close stops server and clean up files.
 func (env *Env) Close() {
 	env.server.Close()
+	env.js.Close()
+	env.backend.Close()
 	os.RemoveAll(env.dataDir)
 }
 
@@ -73,7 +96,9 @@ func newMockConfig() (*config.Config, error) {
 		DataDir:       dataDir,
 		JSONCacheSize: 10,
 		MetaCacheSize: 32,
+		HistorySize:   3,
 		DefaultAccess: config.Protected,
+		SweepInterval: 50 * time.Millisecond,
 	}, nil
 }
 
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disksing/luson/util"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiry(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	for _, q := range [][2]string{{"ttl", "soon"}, {"ttl", "-1s"}, {"expires", "tomorrow"}, {"sliding", ""}} {
+		res, err := env.at("/").withAuth().withParam(q[0], q[1]).withContent("x").post()
+		r.Nil(err)
+		r.Equal(http.StatusBadRequest, res.Status, q)
+	}
+
+	res, err := env.at("/").withAuth().withParam("ttl", "300ms").withContent("x").post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id + "/_meta").withAuth().get()
+	r.Nil(err)
+	r.NotNil(res.Value.(map[string]interface{})["expires"])
+
+	// The document is deleted from disk by the sweeper.
+	r.Eventually(func() bool {
+		_, err := os.Stat(filepath.Join(env.dataDir, util.DirName(id)))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 50*time.Millisecond)
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
+
+func TestExpiryMeta(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := uuid.NewV4().String()
+
+	res, err := env.at("/" + id).withAuth().withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+
+	past := time.Now().Add(-time.Second).Format(time.RFC3339)
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"expires": "` + past + `"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	// Expired documents are gone at once, before they are swept.
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/" + id + "/_meta").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/_docs").withAuth().get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["docs"], 0)
+
+	// The id can be used again.
+	res, err = env.at("/" + id).withAuth().withContent("y").put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("y", res.Value)
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"slidingTTL": "1h"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	meta := res.Value.(map[string]interface{})
+	r.Equal("1h0m0s", meta["slidingTTL"])
+	r.NotNil(meta["expires"])
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"slidingTTL": null, "expires": null}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Nil(res.Value.(map[string]interface{})["expires"])
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"slidingTTL": "-1s"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
+
+func TestSlidingExpiry(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	res, err := env.at("/").withAuth().withParam("ttl", "500ms").withParam("sliding", "").withContent("x").post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	// Reads keep the document alive past its first expiry.
+	for i := 0; i < 10; i++ {
+		time.Sleep(100 * time.Millisecond)
+		res, err = env.at("/" + id).get()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+	}
+
+	// Reads of the meta data do not push the expiry.
+	r.Eventually(func() bool {
+		res, err := env.at("/" + id + "/_meta").withAuth().get()
+		return err == nil && res.Status == http.StatusNotFound
+	}, 5*time.Second, 100*time.Millisecond)
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
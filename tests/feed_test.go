@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	ID    string
+	Event string
+	Data  map[string]interface{}
+}
+
+type eventStream struct {
+	res *http.Response
+	r   *bufio.Reader
+}
+
+func (env *Env) watch(url string, heads map[string]string) (*eventStream, error) {
+	req, err := http.NewRequest("GET", "http://"+env.addr+url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range heads {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return &eventStream{res: res, r: bufio.NewReader(res.Body)}, nil
+}
+
+func (s *eventStream) next() (*event, error) {
+	var ev event
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev.Event != "" {
+				return &ev, nil
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			if err = json.Unmarshal([]byte(line[6:]), &ev.Data); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (s *eventStream) close() {
+	s.res.Body.Close()
+}
+
+func TestFeed(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	s, err := env.watch("/"+id+"/app", nil)
+	r.Nil(err)
+	defer s.close()
+	r.Equal(http.StatusOK, s.res.StatusCode)
+	r.Equal("text/event-stream", s.res.Header.Get("Content-Type"))
+
+	ev, err := s.next()
+	r.Nil(err)
+	r.Equal("value", ev.Event)
+	r.Equal("1", ev.ID)
+	r.Equal("luson", ev.Data["value"])
+
+	// Changes outside the pointer are not sent.
+	res, err := env.at("/" + id + "/loveFrom/0").withAuth().withContent("Rust").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"app":"luson2"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	ev, err = s.next()
+	r.Nil(err)
+	r.Equal("value", ev.Event)
+	r.Equal("3", ev.ID)
+	r.Equal("luson2", ev.Data["value"])
+	r.Equal(res.Header.Get("ETag"), `"`+ev.Data["etag"].(string)+`"`)
+
+	res, err = env.at("/" + id).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	ev, err = s.next()
+	r.Nil(err)
+	r.Equal("delete", ev.Event)
+}
+
+func TestFeedDiff(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id + "/app").withAuth().withContent("luson2").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	// Resume from version 1, the missed change is sent as a patch.
+	s, err := env.watch("/"+id+"?diff", map[string]string{"Last-Event-ID": "1"})
+	r.Nil(err)
+	defer s.close()
+	ev, err := s.next()
+	r.Nil(err)
+	r.Equal("patch", ev.Event)
+	r.Equal("2", ev.ID)
+	r.Equal([]interface{}{
+		map[string]interface{}{"op": "replace", "path": "/app", "value": "luson2"},
+	}, ev.Data["patch"])
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`[{"op":"remove","path":"/loveFrom/1"},{"op":"add","path":"/author","value":"disksing"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	ev, err = s.next()
+	r.Nil(err)
+	r.Equal("patch", ev.Event)
+	r.Equal("3", ev.ID)
+	r.Equal([]interface{}{
+		map[string]interface{}{"op": "add", "path": "/author", "value": "disksing"},
+		map[string]interface{}{"op": "replace", "path": "/loveFrom/1", "value": "GitHub"},
+		map[string]interface{}{"op": "remove", "path": "/loveFrom/2"},
+	}, ev.Data["patch"])
+}
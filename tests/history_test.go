@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	for i := 1; i <= 5; i++ {
+		res, err := env.at("/"+id+"/app").withAuth().withParam("n", strconv.Itoa(i)).withContent("luson" + strconv.Itoa(i)).put()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+		r.Equal(strconv.Itoa(i+1), res.Header.Get("X-Version"))
+	}
+
+	// The current version and 3 prior ones are kept.
+	res, err := env.at("/" + id + "/_history").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	revs := res.Value.([]interface{})
+	r.Len(revs, 4)
+	latest := revs[0].(map[string]interface{})
+	r.Equal(float64(6), latest["version"])
+	// The query is not recorded, it may hold a share token.
+	r.Equal(map[string]interface{}{"method": "PUT", "uri": "/" + id + "/app"}, latest["origin"])
+
+	res, err = env.at("/"+id+"/app").withParam("version", "4").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("luson3", res.Value)
+	r.Equal("4", res.Header.Get("X-Version"))
+
+	res, err = env.at("/"+id).withParam("version", "1").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/"+id+"/app").withParam("at", time.Now().Add(time.Hour).Format(time.RFC3339)).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("luson5", res.Value)
+
+	res, err = env.at("/"+id+"/app").withParam("at", time.Now().Add(-time.Hour).Format(time.RFC3339)).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/" + id + "/_revert").withRawContent(`{"version":4}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	res, err = env.at("/" + id + "/_revert").withAuth().withRawContent(`{"version":4}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("7", res.Header.Get("X-Version"))
+
+	res, err = env.at("/" + id + "/app").get()
+	r.Nil(err)
+	r.Equal("luson3", res.Value)
+
+	res, err = env.at("/"+id+"/_revert").withAuth().withParam("version", "1").post()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const bookstore = `{"store": {
+  "book": [
+    {"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+    {"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+    {"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+    {"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+  ],
+  "bicycle": {"color": "red", "price": 399}
+}}`
+
+func TestJSONPath(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	res, err := env.at("/").withAuth().withRawContent(bookstore).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	cases := []struct {
+		query  string
+		expect string
+	}{
+		{`$.store.book[*].author`, `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{`$..author`, `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{`$.store.*`, `[{"color":"red","price":399},[{"category":"reference","author":"Nigel Rees","title":"Sayings of the Century","price":8.95},{"category":"fiction","author":"Evelyn Waugh","title":"Sword of Honour","price":12.99},{"category":"fiction","author":"Herman Melville","title":"Moby Dick","isbn":"0-553-21311-3","price":8.99},{"category":"fiction","author":"J. R. R. Tolkien","title":"The Lord of the Rings","isbn":"0-395-19395-8","price":22.99}]]`},
+		{`$.store..price`, `[399,8.95,12.99,8.99,22.99]`},
+		{`$..book[2].title`, `["Moby Dick"]`},
+		{`$..book[-1].title`, `["The Lord of the Rings"]`},
+		{`$..book[0,1].title`, `["Sayings of the Century","Sword of Honour"]`},
+		{`$..book[:2].title`, `["Sayings of the Century","Sword of Honour"]`},
+		{`$..book[::-2].title`, `["The Lord of the Rings","Sword of Honour"]`},
+		{`$..book[1:10:0]`, `[]`},
+		{`$..book[?@.isbn].title`, `["Moby Dick","The Lord of the Rings"]`},
+		{`$..book[?@.price<10].title`, `["Sayings of the Century","Moby Dick"]`},
+		{`$..book[?(@.price > 10 && @.category == 'fiction')].title`, `["Sword of Honour","The Lord of the Rings"]`},
+		{`$..book[?!(@.price < 10 || @.price > 20)].title`, `["Sword of Honour"]`},
+		{`$..book[?@.price == 8.950].title`, `["Sayings of the Century"]`},
+		{`$..book[?@.price == $.store.book[0].price].title`, `["Sayings of the Century"]`},
+		{`$..book[?length(@.title) > 15].title`, `["Sayings of the Century","The Lord of the Rings"]`},
+		{`$..book[?match(@.author, 'H.*')].title`, `["Moby Dick"]`},
+		{`$..book[?search(@.title, "of the")].title`, `["Sayings of the Century","The Lord of the Rings"]`},
+		{`$.store[?count(@.*) > 2]`, `[[{"category":"reference","author":"Nigel Rees","title":"Sayings of the Century","price":8.95},{"category":"fiction","author":"Evelyn Waugh","title":"Sword of Honour","price":12.99},{"category":"fiction","author":"Herman Melville","title":"Moby Dick","isbn":"0-553-21311-3","price":8.99},{"category":"fiction","author":"J. R. R. Tolkien","title":"The Lord of the Rings","isbn":"0-395-19395-8","price":22.99}]]`},
+		{`$..book[?value(@..isbn) == "0-553-21311-3"].title`, `["Moby Dick"]`},
+		{`$..book[?@.nothing == @.missing].title`, `["Sayings of the Century","Sword of Honour","Moby Dick","The Lord of the Rings"]`},
+		{`$["store"]['bicycle']["color"]`, `["red"]`},
+		{`$.nothing`, `[]`},
+		{`$`, `[` + bookstore + `]`},
+	}
+	for _, c := range cases {
+		res, err := env.at("/"+id).withParam("jsonpath", c.query).get()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status, c.query)
+		var expect interface{}
+		r.Nil(json.Unmarshal([]byte(c.expect), &expect))
+		r.Equal(expect, res.Value, c.query)
+	}
+
+	// Normalized paths.
+	res, err = env.at("/"+id).withParam("jsonpath", `$..book[?@.price > 20]['title','isbn']`).withParam("paths", "").get()
+	r.Nil(err)
+	r.Equal([]interface{}{`$['store']['book'][3]['title']`, `$['store']['book'][3]['isbn']`}, res.Value)
+
+	// Relative to the node in the URL.
+	res, err = env.at("/"+id+"/store/bicycle").withParam("jsonpath", `$.*`).withParam("paths", "").get()
+	r.Nil(err)
+	r.Equal([]interface{}{`$['color']`, `$['price']`}, res.Value)
+
+	for _, q := range []string{
+		``, `store`, `$.`, `$[`, `$[01]`, `$[-0]`, `$..`, `$[?@.a]]`,
+		`$[?true]`, `$[?@.* == 1]`, `$[?length(@.*) == 1]`, `$[?count(@) ]`,
+		`$[?match(@.a)]`, `$[?nothing(@)]`, `$['\x']`, ` $`, `$ `,
+		`$[?@.a == 1e9999]`, `$[9007199254740992]`,
+	} {
+		res, err := env.at("/"+id).withParam("jsonpath", q).get()
+		r.Nil(err)
+		r.Equal(http.StatusBadRequest, res.Status, q)
+	}
+}
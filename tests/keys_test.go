@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func mustCreateKey(r *require.Assertions, env *Env, req string) string {
+	res, err := env.at("/_keys").withAuth().withRawContent(req).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	r.NotContains(res.Value.(map[string]interface{}), "hash")
+	return res.Value.(map[string]interface{})["key"].(string)
+}
+
+func TestKeys(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+	other := mustPostExample(r, env)
+
+	reader := mustCreateKey(r, env, `{"name":"reader","scopes":["read"]}`)
+	writer := mustCreateKey(r, env, `{"name":"writer","scopes":["read","write"],"docs":["`+id+`"]}`)
+	creator := mustCreateKey(r, env, `{"name":"creator","scopes":["create"]}`)
+	newID := uuid.NewV4().String()
+	docCreator := mustCreateKey(r, env, `{"name":"docCreator","scopes":["create","read"],"docs":["`+newID+`"]}`)
+	expired := mustCreateKey(r, env, `{"name":"expired","scopes":["admin"],"expires":"`+time.Now().Add(time.Second).Format(time.RFC3339Nano)+`"}`)
+
+	res, err := env.at("/_keys").withAuth().withRawContent(`{"name":"reader","scopes":["read"]}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusConflict, res.Status)
+	res, err = env.at("/_keys").withAuth().withRawContent(`{"name":"x","scopes":["fly"]}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+	res, err = env.at("/_keys").withKey(reader).withRawContent(`{"name":"x","scopes":["admin"]}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	// Secrets are not kept at rest.
+	data, err := ioutil.ReadFile(filepath.Join(env.dataDir, "keys.json"))
+	r.Nil(err)
+	r.Contains(string(data), `"reader"`)
+	r.NotContains(string(data), reader)
+
+	// Scopes are enforced.
+	res, err = env.at("/" + id + "/app").withKey(reader).withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/" + id + "/app").withKey(writer).withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + other + "/app").withKey(writer).withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/").withKey(reader).withRawContent(`{}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/").withKey(creator).withRawContent(`{}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+
+	// Keys restricted to documents create only those.
+	res, err = env.at("/").withKey(docCreator).withRawContent(`{}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/" + newID).withKey(docCreator).withRawContent(`{}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+
+	// Listing is restricted to the documents of the key.
+	res, err = env.at("/_docs").withKey(writer).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	docs := res.Value.(map[string]interface{})["docs"].([]interface{})
+	r.Len(docs, 1)
+	r.Equal(id, docs[0].(map[string]interface{})["id"])
+
+	res, err = env.at("/_keys").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	keys := res.Value.([]interface{})
+	r.Len(keys, 5)
+	r.Equal("creator", keys[0].(map[string]interface{})["name"])
+	r.NotContains(keys[0].(map[string]interface{}), "hash")
+
+	// Expired and revoked keys are rejected.
+	time.Sleep(time.Second)
+	res, err = env.at("/_keys").withKey(expired).get()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	res, err = env.at("/_keys/reader").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/_keys/reader").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/_docs").withKey(reader).get()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+}
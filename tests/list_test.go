@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, mustPostExample(r, env))
+	}
+
+	res, err := env.at("/_docs").get()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	res, err = env.at("/_docs").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	docs := res.Value.(map[string]interface{})["docs"].([]interface{})
+	r.Len(docs, 5)
+	for i, d := range docs {
+		d := d.(map[string]interface{})
+		r.Equal(ids[i], d["id"])
+		r.Equal("protected", d["access"])
+		r.NotEmpty(d["hash"])
+		r.Greater(d["size"], float64(0))
+	}
+
+	// Page through the list.
+	var paged []string
+	req := env.at("/_docs").withAuth().withParam("limit", "2").withParam("order", "desc")
+	for {
+		res, err = req.get()
+		r.Nil(err)
+		r.Equal(http.StatusOK, res.Status)
+		v := res.Value.(map[string]interface{})
+		for _, d := range v["docs"].([]interface{}) {
+			paged = append(paged, d.(map[string]interface{})["id"].(string))
+		}
+		if v["next"] == nil {
+			break
+		}
+		r.NotEmpty(res.Header.Get("Link"))
+		req.withParam("cursor", v["next"].(string))
+	}
+	r.Equal([]string{ids[4], ids[3], ids[2], ids[1], ids[0]}, paged)
+
+	res, err = env.at("/" + ids[1] + "/app").withAuth().withContent("luson2").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	etag := res.Header.Get("ETag")
+
+	res, err = env.at("/_docs").withAuth().withParam("sort", "modified").withParam("order", "desc").withParam("limit", "1").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	doc := res.Value.(map[string]interface{})["docs"].([]interface{})[0].(map[string]interface{})
+	r.Equal(ids[1], doc["id"])
+	r.Equal(etag, `"`+doc["hash"].(string)+`"`)
+
+	res, err = env.at("/" + ids[2]).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/_docs").withAuth().withParam("access", "protected").get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["docs"], 4)
+
+	res, err = env.at("/_docs").withAuth().withParam("access", "private").get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["docs"], 0)
+
+	res, err = env.at("/_docs").withAuth().withParam("cursor", "garbage").get()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
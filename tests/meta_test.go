@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeta(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id + "/_meta").get()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	res, err = env.at("/" + id + "/_meta").withAuth().get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	meta := res.Value.(map[string]interface{})
+	r.Equal(id, meta["id"])
+	r.Equal("protected", meta["access"])
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"access": "public", "name": "luson", "labels": {"env": "prod", "team": "core"}}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("luson", res.Value.(map[string]interface{})["name"])
+
+	// Public documents can be written without a key.
+	res, err = env.at("/" + id + "/app").withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"access": "private", "description": "JSON API server", "labels": {"team": null}}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	meta = res.Value.(map[string]interface{})
+	r.Equal("private", meta["access"])
+	r.Equal("luson", meta["name"])
+	r.Equal("JSON API server", meta["description"])
+	r.Equal(map[string]interface{}{"env": "prod"}, meta["labels"])
+	r.Equal(id, meta["id"])
+
+	res, err = env.at("/" + id + "/app").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/_docs").withAuth().withParam("access", "private").get()
+	r.Nil(err)
+	r.Len(res.Value.(map[string]interface{})["docs"], 1)
+
+	for _, body := range []string{
+		`{"access": "secret"}`,
+		`{"labels": {"Bad Key": "x"}}`,
+		`{"name": 1}`,
+	} {
+		res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(body).patch()
+		r.Nil(err)
+		r.Equal(http.StatusBadRequest, res.Status, body)
+	}
+
+	res, err = env.at("/" + id + "/_meta").withAuth().withRawContent(`{"name": "luson"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/disksing/luson/codec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberPrecision(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	res, err := env.at("/").withAuth().withRawContent(`{"id":9007199254740993,"ratio":0.10000000000000000001,"n":1.0}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	res, err = env.at("/" + id + "/id").get()
+	r.Nil(err)
+	r.Equal(`9007199254740993`, res.RawContent)
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"ts":1596276000123456789}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).get()
+	r.Nil(err)
+	r.JSONEq(`{"id":9007199254740993,"ratio":0.10000000000000000001,"n":1.0,"ts":1596276000123456789}`, res.RawContent)
+	r.Contains(res.RawContent, `9007199254740993`)
+	r.Contains(res.RawContent, `0.10000000000000000001`)
+	r.Contains(res.RawContent, `1596276000123456789`)
+
+	// Numbers compare by value.
+	res, err = env.at("/" + id).withAuth().withRawContent(`[{"op":"test","path":"/n","value":1},{"op":"replace","path":"/n","value":2}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`[{"op":"test","path":"/id","value":9007199254740992}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	// Numbers are kept exact on disk.
+	data, err := ioutil.ReadFile(filepath.Join(env.dataDir, id, "data.json"))
+	r.Nil(err)
+	r.Contains(string(data), `9007199254740993`)
+}
+
+func TestNumberPrecisionCodecs(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	res, err := env.at("/").withAuth().withRawContent(`{"id":123456789012345678901234567890,"neg":-123456789012345678901234567890,"ratio":0.1}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	id := res.RawContent
+
+	res, err = env.at("/"+id+"/id").withHead("Accept", "application/yaml").get()
+	r.Nil(err)
+	r.Equal("123456789012345678901234567890\n", res.RawContent)
+
+	// CBOR has bignums, the others fail instead of rounding.
+	res, err = env.at("/"+id).withHead("Accept", "application/cbor").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	v, err := codec.CBOR.Decode([]byte(res.RawContent))
+	r.Nil(err)
+	r.Equal(json.Number("123456789012345678901234567890"), v.(map[string]interface{})["id"])
+	r.Equal(json.Number("-123456789012345678901234567890"), v.(map[string]interface{})["neg"])
+	for _, mt := range []string{"application/toml", "application/msgpack"} {
+		res, err = env.at("/"+id).withHead("Accept", mt).get()
+		r.Nil(err)
+		r.Equal(http.StatusNotAcceptable, res.Status, mt)
+	}
+	res, err = env.at("/"+id+"/ratio").withHead("Accept", "application/msgpack").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"ratio":0.10000000000000000001}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id+"/ratio").withHead("Accept", "application/yaml").get()
+	r.Nil(err)
+	r.Equal("0.10000000000000000001\n", res.RawContent)
+	for _, mt := range []string{"application/cbor", "application/msgpack"} {
+		res, err = env.at("/"+id+"/ratio").withHead("Accept", mt).get()
+		r.Nil(err)
+		r.Equal(http.StatusNotAcceptable, res.Status, mt)
+	}
+}
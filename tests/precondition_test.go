@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalGet(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	etag := res.Header.Get("ETag")
+	r.NotEmpty(etag)
+	lastModified, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	r.Nil(err)
+
+	res, err = env.at("/"+id).withHead("If-None-Match", etag).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotModified, res.Status)
+	r.Equal(etag, res.Header.Get("ETag"))
+
+	res, err = env.at("/"+id).withHead("If-None-Match", `"0123456789abcdef", `+etag).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotModified, res.Status)
+
+	res, err = env.at("/"+id).withHead("If-None-Match", `"0123456789abcdef"`).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/"+id).withHead("If-Modified-Since", lastModified.Format(http.TimeFormat)).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotModified, res.Status)
+
+	res, err = env.at("/"+id).withHead("If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat)).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+}
+
+func TestConditionalWrite(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id).get()
+	r.Nil(err)
+	etag := res.Header.Get("ETag")
+
+	// Both clients read the same version, the second write loses.
+	res, err = env.at("/"+id+"/app").withAuth().withHead("If-Match", etag).withRawContent(`"luson1"`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	newTag := res.Header.Get("ETag")
+	r.NotEqual(etag, newTag)
+
+	res, err = env.at("/"+id+"/app").withAuth().withHead("If-Match", etag).withRawContent(`"luson2"`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-Match", etag).withRawContent(`{"app":"luson2"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-Match", etag).withRawContent(`[{"op":"remove","path":"/app"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-Match", newTag).withRawContent(`{"app":"luson2"}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	newTag = res.Header.Get("ETag")
+
+	res, err = env.at("/"+id).withAuth().withHead("If-None-Match", newTag).withRawContent(`{}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	res, err = env.at("/"+id).withAuth().withHead("If-None-Match", "*").withRawContent(`{}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	res, err = env.at("/"+id).withAuth().withHead("If-Unmodified-Since", past).withRawContent(`{}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusPreconditionFailed, res.Status)
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	res, err = env.at("/"+id).withAuth().withHead("If-Unmodified-Since", future).withRawContent(`[{"op":"test","path":"/app","value":"luson2"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/app").get()
+	r.Nil(err)
+	r.Equal("luson2", res.Value)
+}
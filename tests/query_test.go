@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFields(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	res, err := env.at("/").withAuth().withRawContent(bookstore).post()
+	r.Nil(err)
+	id := res.RawContent
+
+	res, err = env.at("/"+id+"/store").withParam("fields", "bicycle.color,nothing").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal(map[string]interface{}{"bicycle": map[string]interface{}{"color": "red"}}, res.Value)
+
+	res, err = env.at("/"+id+"/store/book").withParam("fields", "title,title.x,isbn").get()
+	r.Nil(err)
+	r.Equal([]interface{}{
+		map[string]interface{}{"title": "Sayings of the Century"},
+		map[string]interface{}{"title": "Sword of Honour"},
+		map[string]interface{}{"title": "Moby Dick", "isbn": "0-553-21311-3"},
+		map[string]interface{}{"title": "The Lord of the Rings", "isbn": "0-395-19395-8"},
+	}, res.Value)
+
+	res, err = env.at("/"+id+"/store/bicycle/color").withParam("fields", "a").get()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+
+	// The stored document is untouched.
+	res, err = env.at("/" + id + "/store/bicycle").get()
+	r.Nil(err)
+	r.Equal(map[string]interface{}{"color": "red", "price": float64(399)}, res.Value)
+}
+
+func TestArrayOptions(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	res, err := env.at("/").withAuth().withRawContent(bookstore).post()
+	r.Nil(err)
+	id := res.RawContent
+	titles := func(res *Res) []interface{} {
+		var ts []interface{}
+		for _, b := range res.Value.([]interface{}) {
+			ts = append(ts, b.(map[string]interface{})["title"])
+		}
+		return ts
+	}
+
+	res, err = env.at("/"+id+"/store/book").withParam("sort", "-price").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal([]interface{}{"The Lord of the Rings", "Sword of Honour", "Moby Dick", "Sayings of the Century"}, titles(res))
+	r.Equal("4", res.Header.Get("X-Total-Count"))
+
+	res, err = env.at("/"+id+"/store/book").withParam("sort", "category,title").get()
+	r.Nil(err)
+	r.Equal([]interface{}{"Moby Dick", "Sword of Honour", "The Lord of the Rings", "Sayings of the Century"}, titles(res))
+
+	res, err = env.at("/"+id+"/store/book").withParam("filter", "@.price > $[0].price && @.isbn").get()
+	r.Nil(err)
+	r.Equal([]interface{}{"Moby Dick", "The Lord of the Rings"}, titles(res))
+	res, err = env.at("/"+id+"/store/book").withParam("filter", "@.category == 'fiction'").withParam("sort", "price").withParam("limit", "2").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal([]interface{}{"Moby Dick", "Sword of Honour"}, titles(res))
+	r.Equal("3", res.Header.Get("X-Total-Count"))
+	r.Contains(res.Header.Get("Link"), `rel="next"`)
+	r.NotContains(res.Header.Get("Link"), `rel="prev"`)
+
+	res, err = env.at("/"+id+"/store/book").withParam("filter", "@.category == 'fiction'").withParam("sort", "price").withParam("limit", "2").withParam("offset", "2").withParam("fields", "title").get()
+	r.Nil(err)
+	r.Equal([]interface{}{map[string]interface{}{"title": "The Lord of the Rings"}}, res.Value)
+	r.Contains(res.Header.Get("Link"), `rel="prev"`)
+	r.NotContains(res.Header.Get("Link"), `rel="next"`)
+	r.Contains(res.Header.Get("Link"), "offset=2")
+
+	res, err = env.at("/"+id+"/store/book").withParam("offset", "10").get()
+	r.Nil(err)
+	r.Equal([]interface{}{}, res.Value)
+
+	// Applies to the results of JSONPath queries.
+	res, err = env.at("/"+id).withParam("jsonpath", "$..price").withParam("filter", "@ > 10").get()
+	r.Nil(err)
+	r.Equal([]interface{}{float64(399), 12.99, 22.99}, res.Value)
+
+	res, err = env.at("/"+id+"/store/book").withParam("offset", "9223372036854775807").withParam("limit", "1000").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal([]interface{}{}, res.Value)
+	r.Contains(res.Header.Get("Link"), `rel="prev"`)
+	r.NotContains(res.Header.Get("Link"), `rel="next"`)
+
+	for _, q := range [][2]string{{"limit", "0"}, {"limit", "9223372036854775807"}, {"offset", "-1"}, {"sort", "-"}, {"filter", "@.a =="}} {
+		res, err = env.at("/"+id+"/store/book").withParam(q[0], q[1]).get()
+		r.Nil(err)
+		r.Equal(http.StatusBadRequest, res.Status, q)
+	}
+	res, err = env.at("/"+id+"/store").withParam("limit", "1").get()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+}
@@ -41,6 +41,10 @@ func (r *Req) withAuth() *Req {
 	return r.withHead("Authorization", MockAPIKey)
 }
 
+func (r *Req) withKey(key string) *Req {
+	return r.withHead("Authorization", key)
+}
+
 func (r *Req) withPrettyParam() *Req {
 	return r.withParam("pretty", "")
 }
@@ -89,9 +93,9 @@ func (r *Req) exec(method string) (*Res, error) {
 		} else {
 			p += "&"
 		}
-		p += url.PathEscape(k)
+		p += url.QueryEscape(k)
 		if v != "" {
-			p += "=" + url.PathEscape(v)
+			p += "=" + url.QueryEscape(v)
 		}
 	}
 	req, err := http.NewRequest(method,
@@ -116,6 +120,7 @@ func (r *Req) exec(method string) (*Res, error) {
 	err = json.Unmarshal(b, &v)
 	return &Res{
 		Status:     res.StatusCode,
+		Header:     res.Header,
 		RawContent: string(b),
 		IsJSON:     err == nil,
 		Value:      v,
@@ -125,6 +130,7 @@ func (r *Req) exec(method string) (*Res, error) {
 // Res represents server HTTP response.
 type Res struct {
 	Status     int
+	Header     http.Header
 	RawContent string
 	IsJSON     bool
 	Value      interface{}
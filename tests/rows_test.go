@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowsExport(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	res, err := env.at("/").withAuth().withRawContent(`{"records":[
+		{"name":"a","size":1,"owner":{"id":7,"tags":["x","y"]}},
+		{"name":"b, \"c\"","ok":true,"owner":{"id":8},"note":null}
+	]}`).post()
+	r.Nil(err)
+	id := res.RawContent
+
+	res, err = env.at("/"+id+"/records").withHead("Accept", "text/csv").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Contains(res.Header.Get("Content-Type"), "text/csv")
+	r.Equal("name,owner.id,owner.tags,size,note,ok\n"+
+		"a,7,\"[\"\"x\"\",\"\"y\"\"]\",1,,\n"+
+		"\"b, \"\"c\"\"\",8,,,,true\n", res.RawContent)
+
+	res, err = env.at("/"+id+"/records").withHead("Accept", "text/csv").withParam("columns", "owner.id,name").withParam("sort", "-owner.id").get()
+	r.Nil(err)
+	r.Equal("owner.id,name\n8,\"b, \"\"c\"\"\"\n7,a\n", res.RawContent)
+
+	res, err = env.at("/"+id+"/records").withHead("Accept", "application/x-ndjson").withParam("columns", "name,owner.id").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("{\"name\":\"a\",\"owner\":{\"id\":7}}\n{\"name\":\"b, \\\"c\\\"\",\"owner\":{\"id\":8}}\n", res.RawContent)
+
+	res, err = env.at("/"+id).withHead("Accept", "text/csv").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotAcceptable, res.Status)
+	res, err = env.at("/"+id+"/records/0/owner/tags").withHead("Accept", "text/csv").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotAcceptable, res.Status)
+}
+
+func TestRowsImport(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	res, err := env.at("/").withAuth().withRawContent(`{"records":[]}`).post()
+	r.Nil(err)
+	id := res.RawContent
+
+	res, err = env.at("/"+id+"/records").withAuth().withHead("Content-Type", "text/csv").
+		withRawContent("name,owner.id,owner.tags,zip,ok\na,7,\"[1,2]\",02134,true\nb,,,,\n").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id+"/records").withAuth().withHead("Content-Type", "application/x-ndjson").
+		withRawContent("{\"name\":\"c\"}\n\n\"d\"\n").post()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id + "/records").get()
+	r.Nil(err)
+	r.Equal([]interface{}{
+		map[string]interface{}{"name": "a", "owner": map[string]interface{}{"id": float64(7), "tags": []interface{}{float64(1), float64(2)}}, "zip": "02134", "ok": true},
+		map[string]interface{}{"name": "b"},
+		map[string]interface{}{"name": "c"},
+		"d",
+	}, res.Value)
+
+	// Round trip.
+	res, err = env.at("/"+id+"/records").withHead("Accept", "text/csv").withParam("limit", "2").get()
+	r.Nil(err)
+	csv := res.RawContent
+	res, err = env.at("/").withAuth().withHead("Content-Type", "text/csv").withRawContent(csv).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	res, err = env.at("/" + res.RawContent).get()
+	r.Nil(err)
+	r.Len(res.Value, 2)
+	r.Equal("02134", res.Value.([]interface{})[0].(map[string]interface{})["zip"])
+
+	res, err = env.at("/"+id+"/records").withAuth().withHead("Content-Type", "text/csv").withRawContent("a,a.b\n1,2\n").put()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+	res, err = env.at("/" + id + "/records").withAuth().withRawContent(`[1]`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnsupportedMediaType, res.Status)
+	res, err = env.at("/"+id+"/records/0").withAuth().withHead("Content-Type", "text/csv").withRawContent("a\n1\n").post()
+	r.Nil(err)
+	r.Equal(http.StatusNotAcceptable, res.Status)
+	res, err = env.at("/"+id+"/records").withHead("Content-Type", "text/csv").withRawContent("a\n1\n").post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+}
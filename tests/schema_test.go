@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const exampleSchema = `{
+	"type": "object",
+	"required": ["app"],
+	"properties": {
+		"app": {"type": "string", "minLength": 1},
+		"stars": {"type": "integer", "minimum": 0},
+		"loveFrom": {"type": "array", "items": {"$ref": "#/$defs/love"}}
+	},
+	"$defs": {
+		"love": {"anyOf": [{"type": "string"}, {"type": "object", "maxProperties": 1}]}
+	}
+}`
+
+func TestSchema(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id + "/_schema").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	res, err = env.at("/" + id + "/_schema").withRawContent(exampleSchema).put()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+
+	for _, body := range []string{
+		`{"type": "nothing"}`,
+		`{"required": ["app"], "$ref": "#/required"}`,
+		`{"properties": {"a": {"$ref": "#/properties/b/minimum"}, "b": {"minimum": 0}}}`,
+		`{"minLength": 2.5}`,
+		`{"maxItems": -1}`,
+	} {
+		res, err = env.at("/" + id + "/_schema").withAuth().withRawContent(body).put()
+		r.Nil(err)
+		r.Equal(http.StatusBadRequest, res.Status, body)
+	}
+
+	// The current document must conform.
+	res, err = env.at("/" + id + "/_schema").withAuth().withRawContent(`{"type": "array"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusUnprocessableEntity, res.Status)
+
+	// Schemas applying themselves fail instead of running forever, even when
+	// negated.
+	for _, body := range []string{
+		`{"anyOf": [{"$ref": "#"}, {"$ref": "#"}]}`,
+		`{"not": {"$ref": "#"}}`,
+	} {
+		res, err = env.at("/" + id + "/_schema").withAuth().withRawContent(body).put()
+		r.Nil(err)
+		r.Equal(http.StatusUnprocessableEntity, res.Status, body)
+	}
+
+	res, err = env.at("/" + id + "/_schema").withAuth().withRawContent(exampleSchema).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/_schema").get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("object", res.Value.(map[string]interface{})["type"])
+
+	res, err = env.at("/" + id + "/app").withAuth().withContent(1).put()
+	r.Nil(err)
+	r.Equal(http.StatusUnprocessableEntity, res.Status)
+	errs := res.Value.(map[string]interface{})["errors"].([]interface{})
+	r.Len(errs, 1)
+	r.Equal(id, errs[0].(map[string]interface{})["id"])
+	r.Equal("/app", errs[0].(map[string]interface{})["pointer"])
+	r.Equal("type", errs[0].(map[string]interface{})["keyword"])
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"stars": 1.5, "loveFrom": [{"a": 1, "b": 2}]}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusUnprocessableEntity, res.Status)
+	errs = res.Value.(map[string]interface{})["errors"].([]interface{})
+	r.Len(errs, 2)
+	r.Equal("/loveFrom/0", errs[0].(map[string]interface{})["pointer"])
+	r.Equal("/stars", errs[1].(map[string]interface{})["pointer"])
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`[{"op": "remove", "path": "/app"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusUnprocessableEntity, res.Status)
+
+	res, err = env.at("/" + id + "/app").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusUnprocessableEntity, res.Status)
+
+	res, err = env.at("/" + id).withAuth().withRawContent(`{"stars": 42}`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/app").get()
+	r.Nil(err)
+	r.Equal("luson", res.Value)
+
+	res, err = env.at("/" + id + "/_schema").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	res, err = env.at("/" + id + "/app").withAuth().withContent(1).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/disksing/luson/config"
+	"github.com/stretchr/testify/require"
+)
+
+func mustShare(r *require.Assertions, env *Env, id, req string) (string, string) {
+	res, err := env.at("/" + id + "/_share").withAuth().withRawContent(req).post()
+	r.Nil(err)
+	r.Equal(http.StatusCreated, res.Status)
+	v := res.Value.(map[string]interface{})
+	return v["token"].(string), v["url"].(string)
+}
+
+func TestShare(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	env.Conf.DefaultAccess = config.Private
+	id := mustPostExample(r, env)
+
+	res, err := env.at("/" + id + "/_share").withRawContent(`{"ttl": 60}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusUnauthorized, res.Status)
+	res, err = env.at("/" + id + "/_share").withAuth().withRawContent(`{}`).post()
+	r.Nil(err)
+	r.Equal(http.StatusBadRequest, res.Status)
+
+	token, u := mustShare(r, env, id, `{"path": "/loveFrom", "ttl": 60}`)
+	r.Equal("/"+id+"/loveFrom?token="+token, u)
+
+	res, err = env.at("/"+id+"/loveFrom/0").withParam("token", token).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal(map[string]interface{}{"language": "Go"}, res.Value)
+	res, err = env.at("/" + id + "/loveFrom").withKey("Bearer " + token).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	// Outside of the subtree or method.
+	res, err = env.at("/"+id+"/app").withParam("token", token).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/"+id+"/loveFromX").withParam("token", token).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/"+id+"/loveFrom/0").withParam("token", token).withContent("x").put()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/"+id+"/loveFrom").withParam("token", token[:len(token)-2]+"xx").get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	// Write only.
+	writer, _ := mustShare(r, env, id, `{"path": "/loveFrom", "methods": ["PUT", "PATCH"], "ttl": 60}`)
+	res, err = env.at("/"+id+"/loveFrom/2").withParam("token", writer).withContent("vim").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id).withParam("token", writer).withRawContent(`[{"op": "add", "path": "/loveFrom/-", "value": "go"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+	res, err = env.at("/"+id+"/loveFrom").withParam("token", writer).withRawContent(`[{"op": "add", "path": "/-", "value": "go"}]`).patch()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id+"/loveFrom/2").withParam("token", writer).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	// Nodes outside of the subtree cannot be copied or moved into it.
+	for _, op := range []string{"copy", "move"} {
+		res, err = env.at("/"+id+"/loveFrom").withParam("token", writer).withRawContent(`[{"op": "` + op + `", "from": "` + id + `/app", "path": "/-"}]`).patch()
+		r.Nil(err)
+		r.Equal(http.StatusNotFound, res.Status, op)
+	}
+	res, err = env.at("/" + id + "/app").withAuth().get()
+	r.Nil(err)
+	r.Equal("luson", res.Value)
+
+	// Revoke.
+	res, err = env.at("/" + id + "/_share").withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/"+id+"/loveFrom").withParam("token", token).get()
+	r.Nil(err)
+	r.Equal(http.StatusNotFound, res.Status)
+
+	token, _ = mustShare(r, env, id, `{"ttl": 60}`)
+	res, err = env.at("/"+id+"/app").withParam("token", token).get()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	r.Equal("luson", res.Value)
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSClient is an in-process client of the WebSocket protocol.
+type WSClient struct {
+	conn *websocket.Conn
+	seq  int64
+}
+
+func (env *Env) dialWS(auth bool) (*WSClient, error) {
+	header := make(http.Header)
+	if auth {
+		header.Set("Authorization", MockAPIKey)
+	}
+	return env.dialWSHeader(header)
+}
+
+func (env *Env) dialWSHeader(header http.Header) (*WSClient, error) {
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+env.addr+"/_ws", header)
+	if err != nil {
+		return nil, err
+	}
+	return &WSClient{conn: conn}, nil
+}
+
+// Send sends a request, and returns its seq number.
+func (c *WSClient) Send(typ string, m map[string]interface{}) (int64, error) {
+	c.seq++
+	m["type"] = typ
+	m["seq"] = c.seq
+	return c.seq, c.conn.WriteJSON(m)
+}
+
+// Recv waits for the next message.
+func (c *WSClient) Recv() (map[string]interface{}, error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m map[string]interface{}
+	err := c.conn.ReadJSON(&m)
+	return m, err
+}
+
+// Close closes the connection.
+func (c *WSClient) Close() {
+	c.conn.Close()
+}
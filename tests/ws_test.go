@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocket(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id1 := mustPostExample(r, env)
+	id2 := mustPostExample(r, env)
+
+	c, err := env.dialWS(true)
+	r.Nil(err)
+	defer c.Close()
+
+	seq, err := c.Send("subscribe", map[string]interface{}{"id": id1, "path": "/app"})
+	r.Nil(err)
+	m, err := c.Recv()
+	r.Nil(err)
+	r.Equal("ack", m["type"])
+	r.Equal(float64(seq), m["seq"])
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("snapshot", m["type"])
+	r.Equal("luson", m["value"])
+
+	_, err = c.Send("subscribe", map[string]interface{}{"id": id2, "path": "/loveFrom", "diff": true})
+	r.Nil(err)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("ack", m["type"])
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("snapshot", m["type"])
+	r.Len(m["value"], 3)
+
+	// Move a value between the two documents.
+	seq, err = c.Send("patch", map[string]interface{}{
+		"id": id1,
+		"ops": []interface{}{
+			map[string]interface{}{"op": "move", "from": "/app", "path": id2 + "/loveFrom/-"},
+			map[string]interface{}{"op": "add", "path": "/app", "value": "moved"},
+		},
+	})
+	r.Nil(err)
+	var ack map[string]interface{}
+	changes := make(map[string]map[string]interface{})
+	for i := 0; i < 3; i++ {
+		m, err = c.Recv()
+		r.Nil(err)
+		if m["type"] == "ack" {
+			ack = m
+		} else {
+			changes[m["id"].(string)] = m
+		}
+	}
+	r.Equal(float64(seq), ack["seq"])
+	r.NotEmpty(ack["etag"])
+	r.Equal("snapshot", changes[id1]["type"])
+	r.Equal("moved", changes[id1]["value"])
+	r.Equal(ack["etag"], changes[id1]["etag"])
+	r.Equal("patch", changes[id2]["type"])
+	r.Equal([]interface{}{
+		map[string]interface{}{"op": "add", "path": "/-", "value": "luson"},
+	}, changes[id2]["ops"])
+
+	seq, err = c.Send("patch", map[string]interface{}{
+		"id":      id1,
+		"ifMatch": "0123456789abcdef",
+		"ops":     []interface{}{map[string]interface{}{"op": "remove", "path": "/app"}},
+	})
+	r.Nil(err)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("error", m["type"])
+	r.Equal(float64(seq), m["seq"])
+	r.Equal(float64(http.StatusPreconditionFailed), m["status"])
+
+	seq, err = c.Send("unsubscribe", map[string]interface{}{"id": id1, "path": "/app"})
+	r.Nil(err)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("ack", m["type"])
+
+	res, err := env.at("/" + id1 + "/app").withAuth().withContent("ignored").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	res, err = env.at("/" + id2 + "/loveFrom/0").withAuth().withContent("Go").put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal(id2, m["id"])
+}
+
+func TestWebSocketAccess(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id := mustPostExample(r, env)
+
+	c, err := env.dialWS(false)
+	r.Nil(err)
+	defer c.Close()
+
+	seq, err := c.Send("subscribe", map[string]interface{}{"id": id, "path": "app"})
+	r.Nil(err)
+	m, err := c.Recv()
+	r.Nil(err)
+	r.Equal("error", m["type"])
+	r.Equal(float64(seq), m["seq"])
+	r.Equal(float64(http.StatusBadRequest), m["status"])
+
+	_, err = c.Send("subscribe", map[string]interface{}{"id": id})
+	r.Nil(err)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("ack", m["type"])
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("snapshot", m["type"])
+
+	_, err = c.Send("patch", map[string]interface{}{
+		"id":  id,
+		"ops": []interface{}{map[string]interface{}{"op": "remove", "path": "/app"}},
+	})
+	r.Nil(err)
+	m, err = c.Recv()
+	r.Nil(err)
+	r.Equal("error", m["type"])
+	r.Equal(float64(http.StatusUnauthorized), m["status"])
+}
+
+func TestWebSocketAliasDeleted(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+	id1 := mustPostExample(r, env)
+	id2 := mustPostExample(r, env)
+	res, err := env.at("/_aliases/flags").withAuth().withRawContent(`{"id":"` + id1 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+
+	c, err := env.dialWS(true)
+	r.Nil(err)
+	defer c.Close()
+	subscribe := func() {
+		_, err := c.Send("subscribe", map[string]interface{}{"id": "@flags", "path": "/app"})
+		r.Nil(err)
+		m, err := c.Recv()
+		r.Nil(err)
+		r.Equal("ack", m["type"])
+		m, err = c.Recv()
+		r.Nil(err)
+		r.Equal("snapshot", m["type"])
+	}
+	subscribe()
+
+	res, err = env.at("/" + id1).withAuth().delete()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	m, err := c.Recv()
+	r.Nil(err)
+	r.Equal("error", m["type"])
+	r.Equal("@flags", m["id"])
+	r.Equal(float64(http.StatusNotFound), m["status"])
+
+	// The subscription is gone, the alias can be subscribed again.
+	res, err = env.at("/_aliases/flags").withAuth().withRawContent(`{"id":"` + id2 + `"}`).put()
+	r.Nil(err)
+	r.Equal(http.StatusOK, res.Status)
+	subscribe()
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	r := require.New(t)
+	env, err := NewEnv()
+	r.Nil(err)
+	defer env.Close()
+
+	dial := func(origin string) error {
+		c, err := env.dialWSHeader(http.Header{"Origin": {origin}})
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}
+	r.Nil(dial("http://" + env.addr))
+	r.NotNil(dial("http://evil.example"))
+	env.Conf.WSOrigins = []string{"http://app.example"}
+	r.Nil(dial("http://app.example"))
+	r.NotNil(dial("http://evil.example"))
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteFile writes data to a file atomically. The data goes to a temporary
+// file in the same directory which is synced and then renamed over fname, so
+// a crash leaves either the old or the new content, never a truncated file.
+func WriteFile(fname string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(fname)
+	f, err := ioutil.TempFile(dir, "."+base+tempSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, fname)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// SyncDir flushes directory entries, making renames and removals durable.
+func SyncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// IsTempFile reports if a file name is of a temporary file created by
+// WriteFile, which is left by an interrupted write.
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempSuffix)
+}
+
+const tempSuffix = ".tmp"
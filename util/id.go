@@ -0,0 +1,50 @@
+package util
+
+import (
+	"encoding/base32"
+	"regexp"
+	"strings"
+)
+
+// IDRegexp matches the ids documents can have. UUIDs are a subset.
+const IDRegexp = "[A-Za-z0-9][A-Za-z0-9._:-]{0,127}"
+
+var idRegexp = regexp.MustCompile("^" + IDRegexp + "$")
+
+// IsID reports if s is a well-formed document id.
+func IsID(s string) bool {
+	return idRegexp.MatchString(s)
+}
+
+// dirEncoding encodes ids into names which are valid and distinct on any
+// file system, including case-insensitive ones.
+var dirEncoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+// dirPrefix marks encoded dir names, it never starts an UUID.
+const dirPrefix = "_"
+
+// DirName returns the name of the dir which keeps the files of a document.
+// UUIDs are used as is, other ids are encoded so that they cannot refer to
+// anything other than a child of the data dir.
+func DirName(id string) string {
+	if IsUUID(id) {
+		return id
+	}
+	return dirPrefix + dirEncoding.EncodeToString([]byte(id))
+}
+
+// IDFromDirName is the reverse of DirName. It returns false if name is not
+// the dir of a document.
+func IDFromDirName(name string) (string, bool) {
+	if IsUUID(name) {
+		return name, true
+	}
+	if !strings.HasPrefix(name, dirPrefix) {
+		return "", false
+	}
+	b, err := dirEncoding.DecodeString(name[len(dirPrefix):])
+	if err != nil || !IsID(string(b)) || IsUUID(string(b)) {
+		return "", false
+	}
+	return string(b), true
+}
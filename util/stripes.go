@@ -0,0 +1,52 @@
+package util
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Stripes are mutexes picked by hashing keys, so that operations on
+// different keys rarely wait for each other, with a fixed amount of memory.
+type Stripes [stripeCount]sync.Mutex
+
+const stripeCount = 256
+
+func stripe(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % stripeCount)
+}
+
+// Lock locks the stripe of a key.
+func (s *Stripes) Lock(key string) {
+	s[stripe(key)].Lock()
+}
+
+// Unlock unlocks the stripe of a key.
+func (s *Stripes) Unlock(key string) {
+	s[stripe(key)].Unlock()
+}
+
+// LockAll locks the stripes of many keys in ascending order, which avoids
+// deadlocks between callers locking overlapping keys. It returns the
+// function unlocking them.
+func (s *Stripes) LockAll(keys []string) func() {
+	seen := make(map[int]bool, len(keys))
+	idx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		if i := stripe(k); !seen[i] {
+			seen[i] = true
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		s[i].Lock()
+	}
+	return func() {
+		for j := len(idx) - 1; j >= 0; j-- {
+			s[idx[j]].Unlock()
+		}
+	}
+}